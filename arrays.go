@@ -0,0 +1,110 @@
+package samfile
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/petemoore/samfile/v3/sambasic"
+)
+
+// ArrayName returns the SAM BASIC name of the array saved in an
+// FT_NUM_ARRAY or FT_STR_ARRAY file, as recorded in its FileTypeInfo
+// (see sambasic.VariableName), with a trailing '$' for string arrays.
+func (fe *FileEntry) ArrayName() string {
+	name := sambasic.VariableName(fe.FileTypeInfo)
+	if fe.Type == FT_STR_ARRAY {
+		name += "$"
+	}
+	return name
+}
+
+// Array decodes the named FT_NUM_ARRAY or FT_STR_ARRAY file (saved
+// with SAVE ... DATA) with sambasic.DecodeArray, naming it after the
+// array name in its directory entry. Returns an error if the file is
+// not present on disk, is not an array file, or can't be decoded.
+func (di *DiskImage) Array(name string) (*sambasic.Array, error) {
+	dj := di.DiskJournal()
+	slot, err := dj.findFileEntry(name)
+	if err != nil {
+		return nil, err
+	}
+	return di.ReadArray(dj[slot])
+}
+
+// ReadArray decodes the FT_NUM_ARRAY or FT_STR_ARRAY file described by
+// fe, as Array does.
+func (di *DiskImage) ReadArray(fe *FileEntry) (*sambasic.Array, error) {
+	if fe.Type != FT_NUM_ARRAY && fe.Type != FT_STR_ARRAY {
+		return nil, fmt.Errorf("file %v is %v, not an array", fe.Name, fe.Type)
+	}
+	f, err := di.ReadFile(fe)
+	if err != nil {
+		return nil, err
+	}
+	array, _, err := sambasic.DecodeArray(sambasic.VariableName(fe.FileTypeInfo), fe.Type == FT_STR_ARRAY, f.Body)
+	return array, err
+}
+
+// AddArray writes array to the disk image as a new FT_NUM_ARRAY or
+// FT_STR_ARRAY file named name, as SAVE name DATA a() would, so that
+// LOAD name DATA a() restores it. The array's header (type byte and
+// name) is recorded in FileTypeInfo. Returns an error if the array
+// can't be represented by SAM BASIC (see sambasic.Array.Bytes and
+// sambasic.Array.Header), if the disk has no free directory slots, or
+// if there are not enough free sectors to hold it.
+func (di *DiskImage) AddArray(name string, array *sambasic.Array) error {
+	header, err := array.Header()
+	if err != nil {
+		return err
+	}
+	body, err := array.Bytes()
+	if err != nil {
+		return err
+	}
+	fe := &FileEntry{
+		Type:                   FT_NUM_ARRAY,
+		StartAddressPageOffset: 0x8000,
+		ExecutionAddressDiv16K: 0xff,
+		ExecutionAddressMod16K: 0xffff,
+		FileTypeInfo:           header,
+	}
+	if array.StringArray {
+		fe.Type = FT_STR_ARRAY
+	}
+	return di.addFile(name, fe, body)
+}
+
+// AddNumArray writes a numeric array called arrayName with the given
+// dimensions and elements (in row-major order) to the disk image as a
+// new FT_NUM_ARRAY file named name. See AddArray.
+func (di *DiskImage) AddNumArray(name, arrayName string, dimensions []int, values []float64) error {
+	return di.AddArray(name, &sambasic.Array{
+		Name:       arrayName,
+		Dimensions: dimensions,
+		Numbers:    values,
+	})
+}
+
+// AddStringArray writes a string array called arrayName with the
+// given dimensions and strings (in row-major order) to the disk image
+// as a new FT_STR_ARRAY file named name. The last dimension is the
+// length of each string; shorter strings are padded with spaces. See
+// AddArray.
+func (di *DiskImage) AddStringArray(name, arrayName string, dimensions []int, values []string) error {
+	padded := make([]string, len(values))
+	if len(dimensions) > 0 {
+		length := dimensions[len(dimensions)-1]
+		for i, s := range values {
+			if len(s) < length {
+				s += strings.Repeat(" ", length-len(s))
+			}
+			padded[i] = s
+		}
+	}
+	return di.AddArray(name, &sambasic.Array{
+		Name:        arrayName,
+		StringArray: true,
+		Dimensions:  dimensions,
+		Strings:     padded,
+	})
+}
@@ -0,0 +1,65 @@
+package samfile
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/petemoore/samfile/v3/sambasic"
+)
+
+func TestReadArray(t *testing.T) {
+	di := NewDiskImage()
+	fe := &FileEntry{Type: FT_STR_ARRAY}
+	fe.FileTypeInfo[0] = sambasic.VT_STR_ARRAY | 4
+	copy(fe.FileTypeInfo[1:], "wordsxxxxx")
+	if err := di.addFile("words", fe, append([]byte{2, 2, 0, 3, 0}, "catdog"...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := di.AddCodeFile("code", []byte{1}, 0x8000, 0); err != nil {
+		t.Fatal(err)
+	}
+	if name := di.DiskJournal()[0].ArrayName(); name != "word$" {
+		t.Errorf("expected array name word$, got %q", name)
+	}
+	array, err := di.Array("WORDS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if array.String() != "word$(2,3)" || len(array.Strings) != 2 || array.Strings[1] != "dog" {
+		t.Errorf("unexpected array %v %q", array, array.Strings)
+	}
+	if _, err := di.Array("code"); err == nil {
+		t.Errorf("expected error decoding a code file as an array")
+	}
+}
+
+func TestAddArray(t *testing.T) {
+	di := NewDiskImage()
+	if err := di.AddNumArray("levels", "lvl", []int{2, 2}, []float64{1, -2, 0.5, 1000000}); err != nil {
+		t.Fatal(err)
+	}
+	if err := di.AddStringArray("names", "n", []int{3, 4}, []string{"ann", "bob", "cy"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := di.AddStringArray("long", "n", []int{1, 2}, []string{"abc"}); err == nil {
+		t.Errorf("expected an error for a string longer than the array's string length")
+	}
+	levels, err := di.Array("levels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if levels.String() != "lvl(2,2)" || !reflect.DeepEqual(levels.Numbers, []float64{1, -2, 0.5, 1000000}) {
+		t.Errorf("unexpected array %v %v", levels, levels.Numbers)
+	}
+	names, err := di.Array("names")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names.String() != "n$(3,4)" || !reflect.DeepEqual(names.Strings, []string{"ann ", "bob ", "cy  "}) {
+		t.Errorf("unexpected array %v %q", names, names.Strings)
+	}
+	dj := di.DiskJournal()
+	if dj[0].Type != FT_NUM_ARRAY || dj[1].Type != FT_STR_ARRAY || dj[1].ArrayName() != "n$" {
+		t.Errorf("unexpected directory entries %v %v %q", dj[0].Type, dj[1].Type, dj[1].ArrayName())
+	}
+}
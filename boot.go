@@ -0,0 +1,183 @@
+package samfile
+
+import (
+	"fmt"
+)
+
+// The SAM ROM's BOOT routine reads the first data sector of the disk
+// (track 4, sector 1) into memory and only runs it if bytes 256–259 of
+// the sector spell "BOOT". The comparison ignores bit 7 and letter
+// case, so any DOS saved as the first file on the disk carries the
+// signature at offset 256-9 = 247 of its body (the sector's first 9
+// bytes being the file header).
+const (
+	bootSignatureOffset = 256
+	bootSignature       = "BOOT"
+)
+
+// DOSLoadAddress is the load address recorded for a DOS installed by
+// InstallDOS: page 29 (StartAddressPage 0x1D), matching the directory
+// entry of samdos2 on commercial disks. The ROM's BOOT routine ignores
+// it, but LOAD "samdos2" CODE uses it.
+const DOSLoadAddress = 0x78000
+
+// bootSector is where the ROM's BOOT routine expects the DOS to start.
+var bootSector = &Sector{Track: 4, Sector: 1}
+
+// hasBootSignature reports whether data, the contents of track 4
+// sector 1, carries the signature the ROM's BOOT routine checks for.
+func hasBootSignature(data []byte) bool {
+	if len(data) < bootSignatureOffset+len(bootSignature) {
+		return false
+	}
+	for i := 0; i < len(bootSignature); i++ {
+		if (data[bootSignatureOffset+i]^bootSignature[i])&0x5f != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckDOSFile returns an error if dos, the body of a DOS file such as
+// samdos2, would not boot when installed as the first file on a disk
+// because it lacks the "BOOT" signature at body offset 247.
+func CheckDOSFile(dos []byte) error {
+	sector := make([]byte, 9, 9+len(dos))
+	if !hasBootSignature(append(sector, dos...)) {
+		return fmt.Errorf("DOS file has no %q signature at offset %v so would not boot", bootSignature, bootSignatureOffset-9)
+	}
+	return nil
+}
+
+// Bootable returns nil if the SAM ROM's BOOT routine would find a DOS
+// on the disk, i.e. if track 4 sector 1 carries the "BOOT" signature,
+// or otherwise an error saying why the disk won't boot.
+func (di *DiskImage) Bootable() error {
+	sd, _ := di.SectorData(bootSector)
+	if !hasBootSignature(sd[:]) {
+		return fmt.Errorf("%v has no %q signature at offset %v", bootSector, bootSignature, bootSignatureOffset)
+	}
+	return nil
+}
+
+// InstallDOS adds dos, the body of a DOS file such as samdos2, to the
+// disk as CODE file name in directory slot 0 starting at track 4
+// sector 1, so that the ROM's BOOT routine finds and runs it. The file
+// is recorded with load address DOSLoadAddress.
+//
+// Room is made for the DOS if necessary: a DOS already installed in
+// slot 0 is replaced, a file occupying slot 0 is moved to the first
+// free slot (so it lists later in DIR), and a sector of another file
+// at track 4 sector 1 is moved to the first free sector, relinking
+// the file's sector chain. Other files are left where they are.
+//
+// Returns an error, leaving the image untouched, if dos fails
+// CheckDOSFile, if the disk lacks the free slot or sectors needed, or
+// if the file at track 4 sector 1 has a broken or cross-linked sector
+// chain (see Check and Repair).
+func (di *DiskImage) InstallDOS(name string, dos []byte) error {
+	if err := CheckDOSFile(dos); err != nil {
+		return err
+	}
+	image := *di
+	dj := image.DiskJournal()
+	if fe := dj[0]; fe.Used() && *fe.FirstSector == *bootSector && image.Bootable() == nil {
+		fe.Type = FT_ERASED
+		image.WriteFileEntry(dj, 0)
+	}
+	if err := image.relocateBootSector(); err != nil {
+		return fmt.Errorf("cannot install DOS %q: %v", name, err)
+	}
+	if err := image.vacateFirstSlot(); err != nil {
+		return fmt.Errorf("cannot install DOS %q: %v", name, err)
+	}
+	if err := image.AddCodeFile(name, dos, DOSLoadAddress, 0); err != nil {
+		return err
+	}
+	*di = image
+	return nil
+}
+
+// relocateBootSector moves the file sector at track 4 sector 1, if
+// any, to the first free data sector and relinks the owning file's
+// sector chain, leaving track 4 sector 1 free.
+func (di *DiskImage) relocateBootSector() error {
+	dj := di.DiskJournal()
+	offset, mask := bootSector.SAMMask()
+	owners := []int{}
+	for _, slot := range dj.UsedFileEntries() {
+		if dj[slot].SectorAddressMap[offset]&mask != 0 {
+			owners = append(owners, slot)
+		}
+	}
+	switch len(owners) {
+	case 0:
+		return nil
+	case 1:
+	default:
+		return fmt.Errorf("%v is cross-linked between %v files; run fsck", bootSector, len(owners))
+	}
+	slot := owners[0]
+	fe := dj[slot]
+	chain, kind, description := di.sectorChain(fe.FirstSector)
+	if kind != "" {
+		return fmt.Errorf("file %q has a broken sector chain (%v: %v); run fsck --repair first", fe.Name.String(), kind, description)
+	}
+	index := -1
+	for i, sector := range chain {
+		if *sector == *bootSector {
+			index = i
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("file %q claims %v but its sector chain doesn't use it; run fsck --repair first", fe.Name.String(), bootSector)
+	}
+	free := dj.CombinedSectorMap().FreeSectors()
+	if len(free) == 0 {
+		return fmt.Errorf("no free sector to move file %q's %v to", fe.Name.String(), bootSector)
+	}
+	target := free[0]
+	sd, _ := di.SectorData(bootSector)
+	di.WriteSector(target, sd)
+	di.WriteSector(bootSector, &SectorData{})
+	if index == 0 {
+		fe.FirstSector = target
+	} else {
+		previous, _ := di.SectorData(chain[index-1])
+		previous[510] = target.Track
+		previous[511] = target.Sector
+		di.WriteSector(chain[index-1], previous)
+	}
+	fe.SectorAddressMap[offset] &^= mask
+	targetOffset, targetMask := target.SAMMask()
+	fe.SectorAddressMap[targetOffset] |= targetMask
+	di.WriteFileEntry(dj, slot)
+	return nil
+}
+
+// vacateFirstSlot moves the file in directory slot 0, if any, to the
+// first free slot. On a labelled disk the moved entry gets a fresh
+// copy of its header mirror, as slot 0's mirror bytes hold the label
+// (which stays in slot 0).
+func (di *DiskImage) vacateFirstSlot() error {
+	dj := di.DiskJournal()
+	if !dj[0].Used() {
+		return nil
+	}
+	free := dj.FreeFileEntries()
+	if len(free) == 0 {
+		return fmt.Errorf("directory is full so file %q can't be moved out of slot 0", dj[0].Name.String())
+	}
+	moved := *dj[0]
+	if di.Label() != "" {
+		moved.MGTFutureAndPast = [10]byte{}
+		if sd, err := di.SectorData(moved.FirstSector); err == nil {
+			copy(moved.MGTFutureAndPast[1:10], sd[:9])
+		}
+	}
+	dj[free[0]] = &moved
+	di.WriteFileEntry(dj, free[0])
+	dj[0].Type = FT_ERASED
+	di.WriteFileEntry(dj, 0)
+	return nil
+}
@@ -0,0 +1,152 @@
+package samfile
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func testDOS(size int) []byte {
+	dos := make([]byte, size)
+	copy(dos[bootSignatureOffset-9:], "BOOT")
+	return dos
+}
+
+func TestInstallDOS(t *testing.T) {
+	di := NewDiskImage()
+	if err := di.SetLabel("MYDISK"); err != nil {
+		t.Fatal(err)
+	}
+	if err := di.InstallDOS("samdos2", testDOS(10000)); err != nil {
+		t.Fatal(err)
+	}
+	fe := di.DiskJournal()[0]
+	if fe.Name.String() != "samdos2" || fe.Type != FT_CODE {
+		t.Fatalf("expected CODE file samdos2 in slot 0, got %v %v", fe.Type, fe.Name)
+	}
+	if *fe.FirstSector != *bootSector {
+		t.Errorf("expected DOS to start at %v, got %v", bootSector, fe.FirstSector)
+	}
+	sd, err := di.SectorData(bootSector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasBootSignature(sd[:]) {
+		t.Errorf("boot sector lacks BOOT signature")
+	}
+	if label := di.Label(); label != "MYDISK" {
+		t.Errorf("expected label to survive installing the DOS, got %q", label)
+	}
+	if problems := di.Check(); len(problems) != 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+	if err := di.InstallDOS("masterdos", testDOS(20000)); err != nil {
+		t.Fatal(err)
+	}
+	if fe := di.DiskJournal()[0]; fe.Name.String() != "masterdos" || fe.Length() != 20000 {
+		t.Errorf("expected installed DOS to be replaced, got %v (%v bytes)", fe.Name, fe.Length())
+	}
+	if _, err := di.File("samdos2"); err == nil {
+		t.Errorf("expected replaced DOS to be erased")
+	}
+}
+
+func TestInstallDOSRelocatesOccupants(t *testing.T) {
+	di := NewDiskImage()
+	bodies := map[string][]byte{}
+	for i, name := range []string{"first", "second"} {
+		body := make([]byte, 1500+i)
+		for j := range body {
+			body[j] = byte(i + j)
+		}
+		bodies[name] = body
+		if err := di.AddCodeFile(name, body, 0x8000, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := di.Bootable(); err == nil {
+		t.Errorf("expected image without DOS not to be bootable")
+	}
+	// "first" occupies both slot 0 and track 4 sector 1.
+	if err := di.InstallDOS("samdos2", testDOS(600)); err != nil {
+		t.Fatal(err)
+	}
+	if err := di.Bootable(); err != nil {
+		t.Errorf("expected image to be bootable: %v", err)
+	}
+	dj := di.DiskJournal()
+	if dj[0].Name.String() != "samdos2" || *dj[0].FirstSector != *bootSector {
+		t.Errorf("expected samdos2 at slot 0, %v; got %v at %v", bootSector, dj[0].Name, dj[0].FirstSector)
+	}
+	for name, body := range bodies {
+		f, err := di.File(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(f.Body, body) {
+			t.Errorf("file %v changed by installing DOS", name)
+		}
+	}
+	if problems := di.Check(); len(problems) != 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+}
+
+func TestInstallDOSFullDisk(t *testing.T) {
+	di := NewDiskImage()
+	for i := 0; i < 80; i++ {
+		if err := di.AddCodeFile(fmt.Sprintf("f%v", i), []byte{byte(i)}, 0x8000, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := *di
+	if err := di.InstallDOS("samdos2", testDOS(600)); err == nil {
+		t.Errorf("expected error installing DOS into full directory")
+	}
+	if *di != before {
+		t.Errorf("failed InstallDOS modified the image")
+	}
+}
+
+func TestCheckDOSFile(t *testing.T) {
+	dos := testDOS(1000)
+	copy(dos[bootSignatureOffset-9:], "boot")
+	if err := CheckDOSFile(dos); err != nil {
+		t.Errorf("lower case signature should be accepted: %v", err)
+	}
+	for _, dos := range [][]byte{make([]byte, 1000), make([]byte, 100)} {
+		if err := CheckDOSFile(dos); err == nil {
+			t.Errorf("expected error for %v byte DOS without signature", len(dos))
+		}
+	}
+}
+
+func TestLabel(t *testing.T) {
+	if label := testImage(t).Label(); label != "ETRACKER.." {
+		t.Errorf("expected label ETRACKER.., got %q", label)
+	}
+	di := NewDiskImage()
+	if label := di.Label(); label != "" {
+		t.Errorf("expected empty label, got %q", label)
+	}
+	if err := di.AddCodeFile("code", make([]byte, 100), 0x8000, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := di.SetLabel("LABEL"); err != nil {
+		t.Fatal(err)
+	}
+	if problems := di.Check(); len(problems) != 0 {
+		t.Errorf("expected no problems with labelled disk, got %v", problems)
+	}
+	if err := di.SetLabel(""); err != nil {
+		t.Fatal(err)
+	}
+	if problems := di.Check(); len(problems) != 0 {
+		t.Errorf("expected header mirror to be restored, got %v", problems)
+	}
+	for _, label := range []string{"ELEVENCHARS", " LEADING"} {
+		if err := di.SetLabel(label); err == nil {
+			t.Errorf("expected error for label %q", label)
+		}
+	}
+}
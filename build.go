@@ -0,0 +1,237 @@
+package samfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/petemoore/samfile/v3/sambasic"
+)
+
+type (
+	// BuildSpec describes a disk image for Build: its label, DOS and
+	// files, in the order they are written to the disk.
+	BuildSpec struct {
+		// Label, if set, is the disk label (see SetLabel).
+		Label string `json:"label,omitempty"`
+		// DOS, if set, is the path of a DOS file to install first
+		// (see InstallDOS), named after the file.
+		DOS   string       `json:"dos,omitempty"`
+		Files []*BuildFile `json:"files"`
+	}
+
+	// BuildFile is a file of a BuildSpec. Source is the path of the
+	// host file it is made from; Type says how:
+	//
+	//   - "code" (the default): Source is stored as it is, to load at
+	//     Load and, if set, execute at Exec.
+	//   - "basic": Source is SAM BASIC text, tokenised as by
+	//     sambasic.ParseText, to auto-RUN from StartLine if set.
+	//   - "screen": Source is a PNG image, stored as a SCREEN$ file
+	//     for screen mode Mode (see EncodeScreen).
+	//   - "array": Source is JSON, or CSV if its extension is .csv,
+	//     stored as array Array (a string array if it ends in '$').
+	//   - "snapshot": Source is a .sna or .z80 file, stored as a ZX
+	//     snapshot file.
+	//
+	// Name defaults to the base name of Source, without its extension
+	// for all but code files (as `samfile add` names files).
+	BuildFile struct {
+		Name       string   `json:"name,omitempty"`
+		Type       string   `json:"type,omitempty"`
+		Source     string   `json:"source"`
+		Load       uint32   `json:"load,omitempty"`
+		Exec       uint32   `json:"exec,omitempty"`
+		StartLine  *uint16  `json:"start_line,omitempty"`
+		Mode       int      `json:"mode,omitempty"`
+		Array      string   `json:"array,omitempty"`
+		Attributes []string `json:"attributes,omitempty"`
+	}
+)
+
+// ReadBuildSpec reads a BuildSpec from JSON file filename. Unknown
+// fields are an error, so that misspelt fields aren't ignored.
+func ReadBuildSpec(filename string) (*BuildSpec, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	spec := &BuildSpec{}
+	if err := decoder.Decode(spec); err != nil {
+		return nil, fmt.Errorf("cannot parse %v: %v", filename, err)
+	}
+	return spec, nil
+}
+
+// Build returns a new disk image made as spec describes. Relative paths
+// in spec are relative to directory dir; absolute paths are used as
+// they are. Returns an error naming the
+// file concerned if a source can't be read or converted, a file
+// doesn't fit on the disk, a name is longer than 10 bytes (see
+// FilenameFrom), or two files have the same name.
+func Build(spec *BuildSpec, dir string) (*DiskImage, error) {
+	di := NewDiskImage()
+	if spec.Label != "" {
+		if err := di.SetLabel(spec.Label); err != nil {
+			return nil, err
+		}
+	}
+	if spec.DOS != "" {
+		name := filepath.Base(spec.DOS)
+		if _, err := FilenameFrom(name); err != nil {
+			return nil, fmt.Errorf("dos %v: %v", spec.DOS, err)
+		}
+		data, err := os.ReadFile(buildPath(dir, spec.DOS))
+		if err != nil {
+			return nil, err
+		}
+		if err := di.InstallDOS(name, data); err != nil {
+			return nil, fmt.Errorf("dos %v: %v", spec.DOS, err)
+		}
+	}
+	for i, file := range spec.Files {
+		if err := di.buildFile(file, dir); err != nil {
+			return nil, fmt.Errorf("file %v (%v): %v", i+1, file.Source, err)
+		}
+	}
+	return di, nil
+}
+
+// buildPath returns path, or path joined to directory dir if path is
+// relative.
+func buildPath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// buildFile adds file, whose Source is relative to directory dir
+// unless absolute, to di.
+func (di *DiskImage) buildFile(file *BuildFile, dir string) error {
+	if file.Source == "" {
+		return fmt.Errorf("no source")
+	}
+	kind := file.Type
+	if kind == "" {
+		kind = "code"
+	}
+	name := file.Name
+	if name == "" {
+		name = filepath.Base(file.Source)
+		if kind != "code" {
+			name = strings.TrimSuffix(name, filepath.Ext(name))
+		}
+	}
+	if _, err := FilenameFrom(name); err != nil {
+		return err
+	}
+	if _, err := di.DiskJournal().findFileEntry(name); err == nil {
+		return fmt.Errorf("a file named %q is already on the disk", name)
+	}
+	attributes, err := parseAttributes(file.Attributes)
+	if err != nil {
+		return err
+	}
+	switch {
+	case kind != "code" && (file.Load != 0 || file.Exec != 0):
+		return fmt.Errorf("load and exec only apply to code files")
+	case kind != "basic" && file.StartLine != nil:
+		return fmt.Errorf("start_line only applies to basic files")
+	case kind != "screen" && file.Mode != 0:
+		return fmt.Errorf("mode only applies to screen files")
+	case kind != "array" && file.Array != "":
+		return fmt.Errorf("array only applies to array files")
+	}
+	source := buildPath(dir, file.Source)
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case "code":
+		if file.Load == 0 {
+			return fmt.Errorf("no load address")
+		}
+		err = di.AddCodeFile(name, data, file.Load, file.Exec)
+	case "basic":
+		var program *sambasic.File
+		program, err = sambasic.ParseText(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		program.StartLine = 0xffff
+		if file.StartLine != nil {
+			program.StartLine = *file.StartLine
+		}
+		err = di.AddBasicFile(name, program)
+	case "screen":
+		img, decodeErr := png.Decode(bytes.NewReader(data))
+		if decodeErr != nil {
+			return fmt.Errorf("can't read PNG: %v", decodeErr)
+		}
+		err = di.AddScreenFile(name, img, file.Mode)
+	case "array":
+		if file.Array == "" {
+			return fmt.Errorf("no array name")
+		}
+		stringArray := strings.HasSuffix(file.Array, "$")
+		arrayName := strings.TrimSuffix(file.Array, "$")
+		var array *sambasic.Array
+		if strings.EqualFold(filepath.Ext(source), ".csv") {
+			array, err = sambasic.ReadArrayCSV(bytes.NewReader(data), arrayName, stringArray)
+		} else {
+			array, err = sambasic.ReadArrayJSON(bytes.NewReader(data), arrayName, stringArray)
+		}
+		if err != nil {
+			return err
+		}
+		err = di.AddArray(name, array)
+	case "snapshot":
+		var s *Snapshot
+		switch strings.ToLower(filepath.Ext(source)) {
+		case ".sna":
+			s, err = SnapshotFromSNA(data)
+		case ".z80":
+			s, err = SnapshotFromZ80(data)
+		default:
+			return fmt.Errorf("snapshot source must have extension .sna or .z80")
+		}
+		if err != nil {
+			return err
+		}
+		err = di.AddSnapshot(name, s)
+	default:
+		return fmt.Errorf("unknown type %q (must be code, basic, screen, array or snapshot)", kind)
+	}
+	if err != nil {
+		return err
+	}
+	if attributes != 0 {
+		return di.SetFileAttributes(name, attributes)
+	}
+	return nil
+}
+
+// parseAttributes returns the FileAttributes named by names, as
+// written by FileAttributes.String ("HIDDEN", "PROTECTED").
+func parseAttributes(names []string) (FileAttributes, error) {
+	attributes := FileAttributes(0)
+	for _, name := range names {
+		switch name {
+		case "HIDDEN":
+			attributes |= FA_HIDDEN
+		case "PROTECTED":
+			attributes |= FA_PROTECTED
+		default:
+			return 0, fmt.Errorf("unknown attribute %q (must be HIDDEN or PROTECTED)", name)
+		}
+	}
+	return attributes, nil
+}
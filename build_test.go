@@ -0,0 +1,125 @@
+package samfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeBuildFiles writes files (name to contents) to a new temporary
+// directory, and returns the directory.
+func writeBuildFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestBuild(t *testing.T) {
+	dir := writeBuildFiles(t, map[string]string{
+		"disk.json": `{
+			"label": "GAME",
+			"files": [
+				{"source": "loader.bas", "type": "basic", "name": "AUTO", "start_line": 10},
+				{"source": "game.bin", "load": 32768, "exec": 32770, "attributes": ["PROTECTED"]},
+				{"source": "scores.csv", "type": "array", "array": "s$"}
+			]
+		}`,
+		"loader.bas": "10 PRINT \"HI\"\n20 GO TO 10\n",
+		"game.bin":   "\x01\x02\x03\x04",
+		"scores.csv": "AB,CD\n",
+	})
+	spec, err := ReadBuildSpec(filepath.Join(dir, "disk.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	di, err := Build(spec, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label := di.Label(); label != "GAME" {
+		t.Errorf("expected label GAME but got %q", label)
+	}
+	entries := di.DiskJournal().List()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 files but got %v", len(entries))
+	}
+	if e := entries[0]; e.Name != "AUTO" || e.Type != "SAM BASIC" || e.StartLine == nil || *e.StartLine != 10 {
+		t.Errorf("unexpected BASIC file %+v", e)
+	}
+	if e := entries[1]; e.Name != "game.bin" || e.Start != 32768 || e.ExecutionAddress == nil || *e.ExecutionAddress != 32770 || len(e.Attributes) != 1 {
+		t.Errorf("unexpected code file %+v", e)
+	}
+	if e := entries[2]; e.Name != "scores" || e.ArrayName != "s$" {
+		t.Errorf("unexpected array file %+v", e)
+	}
+	if problems := di.Check(); len(problems) != 0 {
+		t.Errorf("unexpected problems %v", problems)
+	}
+}
+
+func TestBuildAbsoluteSource(t *testing.T) {
+	sources := writeBuildFiles(t, map[string]string{
+		"game.bin": "\x01\x02\x03",
+	})
+	spec := &BuildSpec{Files: []*BuildFile{
+		{Source: filepath.Join(sources, "game.bin"), Load: 32768},
+	}}
+	di, err := Build(spec, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := di.DiskJournal().List(); len(entries) != 1 || entries[0].Name != "game.bin" {
+		t.Errorf("unexpected files %+v", entries)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	dir := writeBuildFiles(t, map[string]string{
+		"a.bin":             "a",
+		"longfilename1.bin": "1",
+		"bad.bas":           "10 PRINT 1\n99999 PRINT 2\n",
+		"big.bin":           strings.Repeat("x", 450000),
+	})
+	for name, test := range map[string]struct {
+		file *BuildFile
+		want string
+	}{
+		"missing load":   {&BuildFile{Source: "a.bin"}, "no load address"},
+		"missing source": {&BuildFile{Source: "none.bin", Load: 32768}, "none.bin"},
+		"unknown type":   {&BuildFile{Source: "a.bin", Type: "text"}, "unknown type"},
+		"wrong field":    {&BuildFile{Source: "a.bin", Load: 32768, Mode: 4}, "mode only applies"},
+		"attribute":      {&BuildFile{Source: "a.bin", Load: 32768, Attributes: []string{"SECRET"}}, "unknown attribute"},
+		"parse error":    {&BuildFile{Source: "bad.bas", Type: "basic"}, "line 2, col 6: line number out of range"},
+		"long name":      {&BuildFile{Source: "longfilename1.bin", Load: 32768}, "limited to 10 bytes"},
+	} {
+		_, err := Build(&BuildSpec{Files: []*BuildFile{test.file}}, dir)
+		if err == nil || !strings.Contains(err.Error(), test.want) || !strings.HasPrefix(err.Error(), "file 1 ") {
+			t.Errorf("%v: expected an error for file 1 containing %q but got %v", name, test.want, err)
+		}
+	}
+	_, err := Build(&BuildSpec{Files: []*BuildFile{
+		{Source: "big.bin", Load: 32768},
+		{Source: "big.bin", Load: 32768, Name: "BIG2"},
+	}}, dir)
+	if err == nil || !strings.HasPrefix(err.Error(), "file 2 (big.bin): ") || !strings.Contains(err.Error(), "not enough space") {
+		t.Errorf("expected file 2 not to fit but got %v", err)
+	}
+	_, err = Build(&BuildSpec{Files: []*BuildFile{
+		{Source: "a.bin", Load: 32768},
+		{Source: "a.bin", Load: 32768, Name: "A.BIN"},
+	}}, dir)
+	if err == nil || !strings.Contains(err.Error(), "already on the disk") {
+		t.Errorf("expected an error adding a second file named A.BIN but got %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "disk.json"), []byte(`{"files": [{"source": "a.bin", "laod": 32768}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadBuildSpec(filepath.Join(dir, "disk.json")); err == nil || !strings.Contains(err.Error(), "laod") {
+		t.Errorf("expected an error for unknown field laod but got %v", err)
+	}
+}
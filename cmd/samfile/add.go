@@ -1,12 +1,17 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"image/png"
 	"log"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/petemoore/samfile/v3"
+	"github.com/petemoore/samfile/v3/sambasic"
 )
 
 func add(arguments map[string]any) {
@@ -18,34 +23,176 @@ func add(arguments map[string]any) {
 	if fileInfo.IsDir() {
 		log.Fatalf("target directory must be an existing file: %v exists, but is a directory", file)
 	}
-	loadAddressStr := arguments["-l"].(string)
-	loadAddress, err := strconv.Atoi(loadAddressStr)
+	imageName := arguments["-i"].(string)
+	diskImage, container, err := samfile.LoadContainer(imageName)
 	if err != nil {
 		log.Fatal(err)
 	}
-	imageName := arguments["-i"].(string)
-	diskImage, err := samfile.Load(imageName)
+	switch {
+	case arguments["--screen"] != nil:
+		err = addScreen(diskImage, file, arguments["--screen"].(string))
+	case arguments["--array"] != nil:
+		err = addArray(diskImage, file, arguments["--array"].(string))
+	case arguments["--snapshot"].(bool):
+		err = addSnapshot(diskImage, file)
+	case arguments["--basic"].(bool):
+		err = addBasic(diskImage, file, arguments["--start-line"])
+	default:
+		err = addCode(diskImage, file, arguments)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = diskImage.SaveContainer(imageName, container)
 	if err != nil {
 		log.Fatal(err)
 	}
+}
+
+func addCode(diskImage *samfile.DiskImage, file string, arguments map[string]any) error {
+	loadAddressStr := arguments["-l"].(string)
+	loadAddress, err := strconv.Atoi(loadAddressStr)
+	if err != nil {
+		return err
+	}
 	executionAddress := 0
 	if arguments["-e"] != nil {
 		executionAddressStr := arguments["-e"].(string)
 		executionAddress, err = strconv.Atoi(executionAddressStr)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 	}
 	data, err := os.ReadFile(file)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	err = diskImage.AddCodeFile(filepath.Base(file), data, uint32(loadAddress), uint32(executionAddress))
+	return diskImage.AddCodeFile(filepath.Base(file), data, uint32(loadAddress), uint32(executionAddress))
+}
+
+// addScreen adds PNG file file as a SCREEN$ file in screen mode mode,
+// named after file without its extension.
+func addScreen(diskImage *samfile.DiskImage, file, mode string) error {
+	screenMode, err := strconv.Atoi(mode)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("invalid screen mode %q: %v", mode, err)
 	}
-	err = diskImage.Save(imageName)
+	f, err := os.Open(file)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return fmt.Errorf("can't read PNG file %v: %v", file, err)
+	}
+	name, err := fileName(file)
+	if err != nil {
+		return err
+	}
+	if err := diskImage.AddScreenFile(name, img, screenMode); err != nil {
+		return fmt.Errorf("can't add %v as a mode %v screen: %v", file, screenMode, err)
+	}
+	return nil
+}
+
+// addArray adds JSON or CSV file file (chosen by its extension) as an
+// array file holding SAM BASIC array arrayName, a string array if
+// arrayName ends in '$'. The file is named after file without its
+// extension.
+func addArray(diskImage *samfile.DiskImage, file, arrayName string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stringArray := strings.HasSuffix(arrayName, "$")
+	arrayName = strings.TrimSuffix(arrayName, "$")
+	var array *sambasic.Array
+	if strings.EqualFold(filepath.Ext(file), ".csv") {
+		array, err = sambasic.ReadArrayCSV(f, arrayName, stringArray)
+	} else {
+		array, err = sambasic.ReadArrayJSON(f, arrayName, stringArray)
+	}
+	if err != nil {
+		return fmt.Errorf("can't read array from %v: %v", file, err)
+	}
+	name, err := fileName(file)
+	if err != nil {
+		return err
+	}
+	if err := diskImage.AddArray(name, array); err != nil {
+		return fmt.Errorf("can't add %v as array %v: %v", file, array, err)
+	}
+	return nil
+}
+
+// addSnapshot adds .sna or .z80 file file (chosen by its extension) as
+// a ZX snapshot file named after file without its extension.
+func addSnapshot(diskImage *samfile.DiskImage, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var s *samfile.Snapshot
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".sna":
+		s, err = samfile.SnapshotFromSNA(data)
+	case ".z80":
+		s, err = samfile.SnapshotFromZ80(data)
+	default:
+		return fmt.Errorf("snapshot file %v must have extension .sna or .z80", file)
+	}
+	if err != nil {
+		return fmt.Errorf("can't read snapshot %v: %v", file, err)
+	}
+	name, err := fileName(file)
+	if err != nil {
+		return err
+	}
+	return diskImage.AddSnapshot(name, s)
+}
+
+// addBasic tokenises SAM BASIC text file file and adds it as a SAM BASIC
+// program named after file without its extension, to auto-RUN from
+// line startLine if it isn't nil. Parse errors are reported as
+// file:line:column.
+func addBasic(diskImage *samfile.DiskImage, file string, startLine any) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	program, err := sambasic.ParseText(f)
+	var parseError *sambasic.ParseError
+	if errors.As(err, &parseError) {
+		return fmt.Errorf("%v:%v:%v: %v", file, parseError.Line, parseError.Col, parseError.Msg)
+	}
+	if err != nil {
+		return fmt.Errorf("can't read %v: %v", file, err)
+	}
+	program.StartLine = 0xffff
+	if startLine != nil {
+		line, err := strconv.ParseUint(startLine.(string), 10, 16)
+		if err != nil || line > 0xfeff {
+			return fmt.Errorf("invalid start line %q (must be 0-65279)", startLine)
+		}
+		program.StartLine = uint16(line)
+	}
+	name, err := fileName(file)
+	if err != nil {
+		return err
+	}
+	return diskImage.AddBasicFile(name, program)
+}
+
+// fileName returns the name of the SAM file made from host file file:
+// its base name without its extension. Returns an error if that is
+// longer than a SAM filename allows, rather than truncating it.
+func fileName(file string) (string, error) {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if _, err := samfile.FilenameFrom(name); err != nil {
+		return "", fmt.Errorf("can't name %v on the disk: %v", file, err)
 	}
+	return name, nil
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	docopt "github.com/docopt/docopt-go"
+	"github.com/petemoore/samfile/v3"
+)
+
+func TestAddBasic(t *testing.T) {
+	dir := t.TempDir()
+	imageFile := filepath.Join(dir, "basic.mgt")
+	if err := samfile.NewDiskImage().Save(imageFile); err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(dir, "loader.bas")
+	if err := os.WriteFile(source, []byte("10 PRINT \"HI\"\n20 GO TO 10\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	command := []string{"add", "-i", imageFile, "-f", source, "--basic", "--start-line", "20"}
+	arguments, err := docopt.Parse(usage("samfile"), command, true, "samfile", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	add(arguments)
+
+	diskImage, err := samfile.Load(imageFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := diskImage.DiskJournal().List()
+	if len(entries) != 1 || entries[0].Name != "loader" || entries[0].Type != "SAM BASIC" || entries[0].StartLine == nil || *entries[0].StartLine != 20 {
+		t.Fatalf("unexpected directory %+v", entries)
+	}
+	f, err := diskImage.File("loader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *entries[0].ProgramLength != 25 || f.Body[0] != 0 || f.Body[1] != 10 {
+		t.Errorf("unexpected program %x", f.Body[:*entries[0].ProgramLength])
+	}
+}
+
+func TestAddBasicErrors(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "bad.bas")
+	if err := os.WriteFile(source, []byte("10 PRINT 1\n99999 PRINT 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := addBasic(samfile.NewDiskImage(), source, nil)
+	if err == nil || !strings.HasSuffix(err.Error(), "bad.bas:2:6: line number out of range: 99999") {
+		t.Errorf("expected a parse error at bad.bas:2:6 but got %v", err)
+	}
+	good := filepath.Join(dir, "good.bas")
+	if err := os.WriteFile(good, []byte("10 STOP\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := addBasic(samfile.NewDiskImage(), good, "65280"); err == nil {
+		t.Errorf("expected an error for start line 65280")
+	}
+	long := filepath.Join(dir, "longfilename1.bas")
+	if err := os.WriteFile(long, []byte("10 STOP\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := addBasic(samfile.NewDiskImage(), long, nil); err == nil || !strings.Contains(err.Error(), "limited to 10 bytes") {
+		t.Errorf("expected an error for an 11 byte name but got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/petemoore/samfile/v3"
+)
+
+func attrib(arguments map[string]any) {
+	imageName := arguments["-i"].(string)
+	file := arguments["-f"].(string)
+	diskImage, container, err := samfile.LoadContainer(imageName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dir := diskImage.DiskJournal()
+	slot, err := dir.Find(file)
+	if err != nil {
+		log.Fatalf("file %q not found in disk image %q", file, imageName)
+	}
+	fe := dir[slot]
+	attributes := fe.Attributes
+	switch {
+	case arguments["--hide"] == true:
+		attributes |= samfile.FA_HIDDEN
+	case arguments["--unhide"] == true:
+		attributes &^= samfile.FA_HIDDEN
+	}
+	switch {
+	case arguments["--protect"] == true:
+		attributes |= samfile.FA_PROTECTED
+	case arguments["--unprotect"] == true:
+		attributes &^= samfile.FA_PROTECTED
+	}
+	if attributes == fe.Attributes {
+		fmt.Printf("%v: %v\n", file, attributes)
+		return
+	}
+	err = diskImage.SetFileAttributes(file, attributes)
+	if err != nil {
+		log.Fatalf("failed to set attributes of %q in disk image %q: %v", file, imageName, err)
+	}
+	err = diskImage.SaveContainer(imageName, container)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	docopt "github.com/docopt/docopt-go"
+	"github.com/petemoore/samfile/v3"
+)
+
+func TestAttribCaseInsensitive(t *testing.T) {
+	imageFile := filepath.Join(t.TempDir(), "attrib.mgt")
+	di := samfile.NewDiskImage()
+	if err := di.AddCodeFile("COMPILER", []byte{1, 2, 3}, 0x8000, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := di.Save(imageFile); err != nil {
+		t.Fatal(err)
+	}
+	command := []string{"attrib", "-i", imageFile, "-f", "compiler", "--protect"}
+	arguments, err := docopt.Parse(usage("samfile"), command, true, "samfile", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrib(arguments)
+
+	diskImage, err := samfile.Load(imageFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attributes := diskImage.DiskJournal()[0].Attributes; attributes != samfile.FA_PROTECTED {
+		t.Errorf("expected COMPILER to be PROTECTED, got %v", attributes)
+	}
+}
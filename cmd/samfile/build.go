@@ -0,0 +1,24 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/petemoore/samfile/v3"
+)
+
+func build(arguments map[string]any) {
+	imageName := arguments["-i"].(string)
+	manifest := arguments["-m"].(string)
+	spec, err := samfile.ReadBuildSpec(manifest)
+	if err != nil {
+		log.Fatal(err)
+	}
+	diskImage, err := samfile.Build(spec, filepath.Dir(manifest))
+	if err != nil {
+		log.Fatalf("failed to build disk image %q from %v: %v", imageName, manifest, err)
+	}
+	if err := diskImage.SaveContainer(imageName, samfile.ContainerFor(imageName)); err != nil {
+		log.Fatal(err)
+	}
+}
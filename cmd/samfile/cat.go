@@ -1,8 +1,11 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/petemoore/samfile/v3"
 )
@@ -15,23 +18,61 @@ func cat(arguments map[string]any) {
 		log.Fatal(err)
 	}
 	dir := diskImage.DiskJournal()
-	fileFound := false
-	for _, diskfile := range dir {
-		if !diskfile.Used() {
-			continue
-		}
-		filename := diskfile.Name.String()
-		if file != filename {
+	slots := dir.Match(file)
+	if len(slots) == 0 {
+		log.Fatalf("file %q not found in disk image %q", file, imageName)
+	}
+	for _, slot := range slots {
+		filename := dir[slot].Name.String()
+		if arguments["--format"] != nil {
+			err = catArray(diskImage, dir[slot], arguments["--format"].(string))
+			if err != nil {
+				log.Fatalf("failed to convert %q from disk image %q: %v", filename, imageName, err)
+			}
 			continue
 		}
-		fileFound = true
-		f, err := diskImage.File(filename)
+		f, err := diskImage.ReadFile(dir[slot])
 		if err != nil {
 			log.Fatalf("failed to extract %q from disk image %q: %v", filename, imageName, err)
 		}
 		_, _ = os.Stdout.Write(f.Body)
 	}
-	if !fileFound {
+}
+
+// matchOne returns the directory entry of the one file in diskImage
+// (loaded from imageName) matching pattern file, exiting if no file or
+// several files match.
+func matchOne(diskImage *samfile.DiskImage, file, imageName string) *samfile.FileEntry {
+	dir := diskImage.DiskJournal()
+	slots := dir.Match(file)
+	switch len(slots) {
+	case 0:
 		log.Fatalf("file %q not found in disk image %q", file, imageName)
+	case 1:
+	default:
+		names := make([]string, len(slots))
+		for i, slot := range slots {
+			names[i] = dir[slot].Name.String()
+		}
+		log.Fatalf("%q matches %v files in disk image %q (%v); it must match exactly one", file, len(slots), imageName, strings.Join(names, ", "))
+	}
+	return dir[slots[0]]
+}
+
+// catArray writes the array file fe to stdout in format "json" or
+// "csv".
+func catArray(diskImage *samfile.DiskImage, fe *samfile.FileEntry, format string) error {
+	if format != "json" && format != "csv" {
+		return fmt.Errorf("unsupported format %q (must be json or csv)", format)
+	}
+	array, err := diskImage.ReadArray(fe)
+	if err != nil {
+		return err
+	}
+	if format == "csv" {
+		return array.WriteCSV(os.Stdout)
 	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(array)
 }
@@ -13,6 +13,14 @@ import (
 )
 
 func TestCatEnolaGayFileFromETrackerDisk(t *testing.T) {
+	testCatETrackerFile(t, "ENOLA_G .M", "c2187c3df8fc4fddbaaad64cc356c66534f34252321b78df01fe43f8a46daa63")
+}
+
+func TestCatMatchesCaseInsensitiveWildcards(t *testing.T) {
+	testCatETrackerFile(t, "enola_?*", "c2187c3df8fc4fddbaaad64cc356c66534f34252321b78df01fe43f8a46daa63")
+}
+
+func testCatETrackerFile(t *testing.T, samFile, expectedSHA256 string) {
 
 	oldStdout := os.Stdout // keep backup of the real stdout
 	defer func(f *os.File) {
@@ -34,8 +42,6 @@ func TestCatEnolaGayFileFromETrackerDisk(t *testing.T) {
 	if err != nil {
 		log.Fatal(err)
 	}
-	samFile := "ENOLA_G .M"
-	expectedSHA256 := "7ff534304084bf3638fb30e00b26105124e3e229981d43e5ec3b4c74cb527d06"
 
 	command := []string{
 		"cat",
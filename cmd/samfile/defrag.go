@@ -0,0 +1,23 @@
+package main
+
+import (
+	"log"
+
+	"github.com/petemoore/samfile/v3"
+)
+
+func defrag(arguments map[string]any) {
+	imageName := arguments["-i"].(string)
+	diskImage, container, err := samfile.LoadContainer(imageName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = diskImage.Defragment()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = diskImage.SaveContainer(imageName, container)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
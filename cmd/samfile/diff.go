@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/petemoore/samfile/v3"
+)
+
+func diff(arguments map[string]any) {
+	imageNameA := arguments["IMAGE_A"].(string)
+	imageNameB := arguments["IMAGE_B"].(string)
+	diskImageA, err := samfile.Load(imageNameA)
+	if err != nil {
+		log.Fatal(err)
+	}
+	diskImageB, err := samfile.Load(imageNameB)
+	if err != nil {
+		log.Fatal(err)
+	}
+	changes := samfile.Diff(diskImageA, diskImageB)
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+}
@@ -26,15 +26,16 @@ func extract(arguments map[string]any) {
 	if err != nil {
 		log.Fatal(err)
 	}
+	pattern := "*"
+	if arguments["-f"] != nil {
+		pattern = arguments["-f"].(string)
+	}
 	dir := diskImage.DiskJournal()
 	fileFound := false
-	for _, diskfile := range dir {
-		if !diskfile.Used() {
-			continue
-		}
+	for _, slot := range dir.Match(pattern) {
 		fileFound = true
-		filename := diskfile.Name.String()
-		f, err := diskImage.File(filename)
+		filename := dir[slot].Name.String()
+		f, err := diskImage.ReadFile(dir[slot])
 		if err != nil {
 			log.Printf("warning: could not extract %q: %v", filename, err)
 			continue
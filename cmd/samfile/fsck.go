@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/petemoore/samfile/v3"
+)
+
+func fsck(arguments map[string]any) {
+	imageName := arguments["-i"].(string)
+	diskImage, container, err := samfile.LoadContainer(imageName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	repair := arguments["--repair"] == true
+	dryRun := arguments["--dry-run"] == true
+	changes := []*samfile.Problem{}
+	if repair {
+		changes = diskImage.Repair()
+		if len(changes) > 0 && !dryRun {
+			err = diskImage.SaveContainer(imageName, container)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	problems := diskImage.Check()
+	switch {
+	case arguments["--json"] != true:
+		for _, change := range changes {
+			if dryRun {
+				fmt.Printf("would repair %v\n", change)
+			} else {
+				fmt.Printf("repaired %v\n", change)
+			}
+		}
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+	case repair:
+		outputJSON(map[string][]*samfile.Problem{
+			"repairs":  changes,
+			"problems": problems,
+		})
+	default:
+		outputJSON(problems)
+	}
+	switch {
+	case len(changes) > 0 && dryRun:
+		log.Printf("%v repair(s) would be made to disk image %q (not saved)", len(changes), imageName)
+	case len(changes) > 0:
+		log.Printf("%v repair(s) made to disk image %q", len(changes), imageName)
+	}
+	if len(problems) > 0 {
+		log.Fatalf("%v problem(s) found in disk image %q", len(problems), imageName)
+	}
+}
+
+func outputJSON(v any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Fatal(err)
+	}
+}
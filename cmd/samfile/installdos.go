@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/petemoore/samfile/v3"
+)
+
+func installDOS(arguments map[string]any) {
+	imageName := arguments["-i"].(string)
+	diskImage, container, err := samfile.LoadContainer(imageName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if arguments["-f"] != nil {
+		dosFile := arguments["-f"].(string)
+		data, err := os.ReadFile(dosFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := diskImage.InstallDOS(filepath.Base(dosFile), data); err != nil {
+			log.Fatal(err)
+		}
+		if err := diskImage.SaveContainer(imageName, container); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := diskImage.Bootable(); err != nil {
+		log.Fatalf("disk image %v is not bootable: %v", imageName, err)
+	}
+	fmt.Printf("disk image %v is bootable", imageName)
+	if fe := diskImage.DiskJournal()[0]; fe.Used() && fe.FirstSector.Track == 4 && fe.FirstSector.Sector == 1 {
+		fmt.Printf(" (DOS: %q)", fe.Name.String())
+	}
+	fmt.Println()
+}
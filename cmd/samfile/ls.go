@@ -1,11 +1,26 @@
 package main
 
 import (
+	"encoding/csv"
+	"fmt"
 	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/petemoore/samfile/v3"
 )
 
+// listColumns are the column headings of `samfile ls --format csv` and
+// `samfile ls --format table`.
+var listColumns = []string{
+	"slot", "name", "type", "attributes", "sectors", "first_track",
+	"first_sector", "start", "length", "execution_address", "start_line",
+	"program_length", "numeric_variables_size", "gap_size",
+	"string_array_variables_size", "array_name", "screen_mode",
+}
+
 func ls(arguments map[string]any) {
 	imageName := arguments["-i"].(string)
 	diskImage, err := samfile.Load(imageName)
@@ -13,5 +28,84 @@ func ls(arguments map[string]any) {
 		log.Fatal(err)
 	}
 	dir := diskImage.DiskJournal()
-	dir.Output()
+	if arguments["--format"] == nil {
+		dir.Output()
+		return
+	}
+	entries := dir.List()
+	switch format := arguments["--format"].(string); format {
+	case "json":
+		outputJSON(entries)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write(listColumns)
+		for _, entry := range entries {
+			w.Write(listRow(entry, ""))
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			log.Fatal(err)
+		}
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, strings.ToUpper(strings.Join(listColumns, "\t")))
+		for _, entry := range entries {
+			fmt.Fprintln(w, strings.Join(listRow(entry, "-"), "\t"))
+		}
+		if err := w.Flush(); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("unsupported format %q (must be json, csv or table)", format)
+	}
+}
+
+// listRow returns the fields of entry in the order of listColumns, with
+// missing for fields that don't apply to the file.
+func listRow(entry *samfile.ListEntry, missing string) []string {
+	optional := func(v *uint32) string {
+		if v == nil {
+			return missing
+		}
+		return strconv.Itoa(int(*v))
+	}
+	attributes := strings.Join(entry.Attributes, "|")
+	if attributes == "" {
+		attributes = missing
+	}
+	start := missing
+	if entry.Start != 0 {
+		start = strconv.Itoa(int(entry.Start))
+	}
+	startLine := missing
+	if entry.StartLine != nil {
+		startLine = strconv.Itoa(int(*entry.StartLine))
+	}
+	arrayName := missing
+	if entry.ArrayName != "" {
+		arrayName = entry.ArrayName
+	}
+	screenMode := missing
+	if entry.ScreenMode != 0 {
+		screenMode = strconv.Itoa(entry.ScreenMode)
+	}
+	return []string{
+		strconv.Itoa(entry.Slot),
+		entry.Name,
+		entry.Type,
+		attributes,
+		strconv.Itoa(entry.Sectors),
+		strconv.Itoa(entry.FirstTrack),
+		strconv.Itoa(entry.FirstSector),
+		start,
+		strconv.Itoa(int(entry.Length)),
+		optional(entry.ExecutionAddress),
+		startLine,
+		optional(entry.ProgramLength),
+		optional(entry.NumericVariablesSize),
+		optional(entry.GapSize),
+		optional(entry.StringArrayVariablesSize),
+		arrayName,
+		screenMode,
+	}
 }
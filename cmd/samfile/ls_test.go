@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/petemoore/samfile/v3"
+)
+
+func TestListRowArrayAndScreen(t *testing.T) {
+	for name, test := range map[string]struct {
+		entry      *samfile.ListEntry
+		arrayName  string
+		screenMode string
+	}{
+		"array":  {&samfile.ListEntry{Name: "scores", Type: "String Array", ArrayName: "s$"}, "s$", "-"},
+		"screen": {&samfile.ListEntry{Name: "title", Type: "Screen", ScreenMode: 4}, "-", "4"},
+		"code":   {&samfile.ListEntry{Name: "game", Type: "Code"}, "-", "-"},
+	} {
+		row := listRow(test.entry, "-")
+		if len(row) != len(listColumns) {
+			t.Fatalf("%v: expected %v fields but got %v", name, len(listColumns), len(row))
+		}
+		fields := map[string]string{}
+		for i, column := range listColumns {
+			fields[column] = row[i]
+		}
+		if fields["array_name"] != test.arrayName || fields["screen_mode"] != test.screenMode {
+			t.Errorf("%v: expected array_name %q and screen_mode %q but got %q and %q", name, test.arrayName, test.screenMode, fields["array_name"], fields["screen_mode"])
+		}
+	}
+}
@@ -1,7 +1,19 @@
-// Command samfile manipulates files inside a SAM Coupé MGT floppy
-// disk image: listing the directory (ls), extracting one or all
-// files (cat / extract), adding a new code file (add), and
-// detokenising a saved SAM BASIC program to plain text
+// Command samfile manipulates files inside a SAM Coupé MGT floppy disk
+// image: creating a new, optionally bootable image (new) or a complete
+// image from a JSON manifest (build), installing a DOS to make an image
+// bootable (install-dos), listing the directory, optionally as JSON,
+// CSV or a table (ls), mapping which file owns each sector, as text,
+// PNG or SVG (map), extracting one or all files, or decoding array
+// files to JSON or CSV (cat / extract), adding a code file, a SAM BASIC
+// program from text, a PNG as a SCREEN$ file, JSON or CSV as an array
+// file or a .sna or .z80 file as a ZX snapshot file (add), deleting or
+// renaming a file (rm / mv), changing file attributes (attrib),
+// checking and defragmenting the disk (fsck / defrag), comparing the
+// files of two images (diff), unpacking an image to a directory of
+// files and a manifest and packing it back, byte for byte (unpack /
+// pack), converting a SCREEN$ file to PNG (screen2png), converting a ZX
+// snapshot file to .sna or .z80 (snapshot), and detokenising a saved
+// SAM BASIC program, and optionally its variables, to plain text
 // (basic-to-text). Run `samfile --help` for invocation details. For
 // programmatic access to MGT images, import the parent package
 // github.com/petemoore/samfile/v3.
@@ -33,18 +45,46 @@ func main() {
 		log.Fatalf("error parsing command line arguments: %v", err)
 	}
 	switch {
+	case arguments["build"]:
+		build(arguments)
 	case arguments["cat"]:
 		cat(arguments)
 	case arguments["extract"]:
 		extract(arguments)
 	case arguments["ls"]:
 		ls(arguments)
+	case arguments["map"]:
+		diskMap(arguments)
 	case arguments["basic-to-text"]:
 		basicToText(arguments)
 	case arguments["text-to-basic"]:
 		textToBasic(arguments)
 	case arguments["add"]:
 		add(arguments)
+	case arguments["rm"]:
+		rm(arguments)
+	case arguments["mv"]:
+		mv(arguments)
+	case arguments["attrib"]:
+		attrib(arguments)
+	case arguments["fsck"]:
+		fsck(arguments)
+	case arguments["diff"]:
+		diff(arguments)
+	case arguments["defrag"]:
+		defrag(arguments)
+	case arguments["new"]:
+		newImage(arguments)
+	case arguments["install-dos"]:
+		installDOS(arguments)
+	case arguments["screen2png"]:
+		screen2png(arguments)
+	case arguments["pack"]:
+		pack(arguments)
+	case arguments["unpack"]:
+		unpack(arguments)
+	case arguments["snapshot"]:
+		snapshot(arguments)
 	default:
 		log.Fatal("could not find a command to run")
 	}
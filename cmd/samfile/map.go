@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/petemoore/samfile/v3"
+)
+
+func diskMap(arguments map[string]any) {
+	imageName := arguments["-i"].(string)
+	diskImage, err := samfile.Load(imageName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	m := diskImage.Map()
+	if arguments["-o"] == nil {
+		if err := m.WriteText(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	output := arguments["-o"].(string)
+	var data bytes.Buffer
+	switch strings.ToLower(filepath.Ext(output)) {
+	case ".png":
+		err = png.Encode(&data, m.Image())
+	case ".svg":
+		err = m.WriteSVG(&data)
+	default:
+		log.Fatalf("output file %v must have extension .png or .svg", output)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(output, data.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"log"
+
+	"github.com/petemoore/samfile/v3"
+)
+
+func mv(arguments map[string]any) {
+	imageName := arguments["-i"].(string)
+	file := arguments["-f"].(string)
+	newName := arguments["-n"].(string)
+	diskImage, container, err := samfile.LoadContainer(imageName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = diskImage.RenameFile(file, newName)
+	if err != nil {
+		log.Fatalf("failed to rename %q in disk image %q: %v", file, imageName, err)
+	}
+	err = diskImage.SaveContainer(imageName, container)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/petemoore/samfile/v3"
+)
+
+func newImage(arguments map[string]any) {
+	imageName := arguments["-i"].(string)
+	if _, err := os.Stat(imageName); err == nil {
+		log.Fatalf("disk image %v already exists", imageName)
+	}
+	diskImage := samfile.NewDiskImage()
+	if arguments["--label"] != nil {
+		if err := diskImage.SetLabel(arguments["--label"].(string)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if arguments["--dos"] != nil {
+		dosFile := arguments["--dos"].(string)
+		data, err := os.ReadFile(dosFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := diskImage.InstallDOS(filepath.Base(dosFile), data); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := diskImage.SaveContainer(imageName, samfile.ContainerFor(imageName)); err != nil {
+		log.Fatal(err)
+	}
+}
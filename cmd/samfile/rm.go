@@ -0,0 +1,25 @@
+package main
+
+import (
+	"log"
+
+	"github.com/petemoore/samfile/v3"
+)
+
+func rm(arguments map[string]any) {
+	imageName := arguments["-i"].(string)
+	file := arguments["-f"].(string)
+	diskImage, container, err := samfile.LoadContainer(imageName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	scrub := arguments["--scrub"] == true
+	err = diskImage.DeleteFile(file, scrub)
+	if err != nil {
+		log.Fatalf("failed to delete %q from disk image %q: %v", file, imageName, err)
+	}
+	err = diskImage.SaveContainer(imageName, container)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -10,6 +11,10 @@ import (
 )
 
 func basicToText(arguments map[string]any) {
+	if v, ok := arguments["--vars"]; ok && v == true {
+		basicFileToText(arguments)
+		return
+	}
 	var buf bytes.Buffer
 	if _, err := io.Copy(&buf, os.Stdin); err != nil {
 		log.Fatal(err)
@@ -22,3 +27,34 @@ func basicToText(arguments map[string]any) {
 		log.Fatal(err)
 	}
 }
+
+// basicFileToText lists SAM BASIC file FILE from disk image IMAGE,
+// followed by a blank line and the variables saved with it.
+func basicFileToText(arguments map[string]any) {
+	imageName := arguments["-i"].(string)
+	file := arguments["-f"].(string)
+	diskImage, err := samfile.Load(imageName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fe := matchOne(diskImage, file, imageName)
+	f, err := diskImage.ReadFile(fe)
+	if err != nil {
+		log.Fatal(err)
+	}
+	vars, err := diskImage.ReadVariables(fe)
+	if err != nil {
+		log.Fatalf("failed to decode variables of %q in disk image %q: %v", fe.Name.String(), imageName, err)
+	}
+	sb := samfile.NewSAMBasic(f.Body)
+	if v, ok := arguments["--lossy"]; ok && v == true {
+		sb.Lossy = true
+	}
+	if err := sb.Output(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println()
+	if err := vars.WriteText(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"image/png"
+	"log"
+	"os"
+
+	"github.com/petemoore/samfile/v3"
+)
+
+func screen2png(arguments map[string]any) {
+	imageName := arguments["-i"].(string)
+	file := arguments["-f"].(string)
+	output := arguments["-o"].(string)
+	diskImage, err := samfile.Load(imageName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fe := matchOne(diskImage, file, imageName)
+	img, err := diskImage.ReadScreen(fe)
+	if err != nil {
+		log.Fatalf("failed to decode %q from disk image %q: %v", fe.Name.String(), imageName, err)
+	}
+	out, err := os.Create(output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := png.Encode(out, img); err != nil {
+		out.Close()
+		log.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
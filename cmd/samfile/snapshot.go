@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/petemoore/samfile/v3"
+)
+
+func snapshot(arguments map[string]any) {
+	imageName := arguments["-i"].(string)
+	file := arguments["-f"].(string)
+	output := arguments["-o"].(string)
+	diskImage, err := samfile.Load(imageName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fe := matchOne(diskImage, file, imageName)
+	s, err := diskImage.ReadSnapshot(fe)
+	if err != nil {
+		log.Fatalf("failed to read snapshot %q from disk image %q: %v", fe.Name.String(), imageName, err)
+	}
+	var data []byte
+	switch strings.ToLower(filepath.Ext(output)) {
+	case ".sna":
+		data, err = s.SNA()
+		if err != nil {
+			log.Fatalf("cannot write %v: %v", output, err)
+		}
+	case ".z80":
+		data = s.Z80()
+	default:
+		log.Fatalf("output file %v must have extension .sna or .z80", output)
+	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	docopt "github.com/docopt/docopt-go"
+	"github.com/petemoore/samfile/v3"
+)
+
+func TestCatAndExtractSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	imageFile := filepath.Join(dir, "snap.mgt")
+	s := &samfile.Snapshot{SP: 0xff00, PC: 0x8000}
+	for i := range s.RAM {
+		s.RAM[i] = byte(i)
+	}
+	di := samfile.NewDiskImage()
+	if err := di.AddSnapshot("SNAP", s); err != nil {
+		t.Fatal(err)
+	}
+	if err := di.Save(imageFile); err != nil {
+		t.Fatal(err)
+	}
+	read, err := di.Snapshot("SNAP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(command ...string) {
+		arguments, err := docopt.Parse(usage("samfile"), command, true, "samfile", false, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commands := map[string]func(map[string]any){"cat": cat, "extract": extract}
+		commands[command[0]](arguments)
+	}
+
+	catFile := filepath.Join(dir, "cat.out")
+	stdout, err := os.Create(catFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStdout := os.Stdout
+	os.Stdout = stdout
+	run("cat", "-i", imageFile, "-f", "snap")
+	os.Stdout = oldStdout
+	stdout.Close()
+
+	target := filepath.Join(dir, "extracted")
+	if err := os.Mkdir(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	run("extract", "-i", imageFile, "-t", target)
+
+	for _, name := range []string{catFile, filepath.Join(target, "SNAP")} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, read.RAM[:]) {
+			t.Errorf("expected %v to hold the %v bytes of RAM, got %v bytes", name, samfile.SnapshotLength, len(data))
+		}
+	}
+}
+
+func TestSnapshotAndScreenPattern(t *testing.T) {
+	dir := t.TempDir()
+	imageFile := filepath.Join(dir, "game.mgt")
+	s := &samfile.Snapshot{SP: 0xff00, PC: 0x8000}
+	di := samfile.NewDiskImage()
+	if err := di.AddSnapshot("GAMESNAP", s); err != nil {
+		t.Fatal(err)
+	}
+	if err := di.AddScreenFile("GAMESCR", image.NewPaletted(image.Rect(0, 0, 256, 192), color.Palette{color.Black, color.White}), 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := di.Save(imageFile); err != nil {
+		t.Fatal(err)
+	}
+	for _, command := range [][]string{
+		{"snapshot", "-i", imageFile, "-f", "game*nap", "-o", filepath.Join(dir, "game.z80")},
+		{"screen2png", "-i", imageFile, "-f", "GAMES?R", "-o", filepath.Join(dir, "game.png")},
+	} {
+		arguments, err := docopt.Parse(usage("samfile"), command, true, "samfile", false, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commands := map[string]func(map[string]any){"snapshot": snapshot, "screen2png": screen2png}
+		commands[command[0]](arguments)
+		if _, err := os.Stat(command[len(command)-1]); err != nil {
+			t.Errorf("%v: %v", command[0], err)
+		}
+	}
+}
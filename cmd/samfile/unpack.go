@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/petemoore/samfile/v3"
+)
+
+func unpack(arguments map[string]any) {
+	imageName := arguments["-i"].(string)
+	dir := arguments["-d"].(string)
+	diskImage, err := samfile.Load(imageName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := diskImage.Unpack(dir); err != nil {
+		log.Fatalf("failed to unpack disk image %q to %v: %v", imageName, dir, err)
+	}
+}
+
+func pack(arguments map[string]any) {
+	imageName := arguments["-i"].(string)
+	dir := arguments["-d"].(string)
+	if _, err := os.Stat(imageName); err == nil {
+		log.Fatalf("disk image %v already exists", imageName)
+	}
+	diskImage, err := samfile.Pack(dir)
+	if err != nil {
+		log.Fatalf("failed to pack %v: %v", dir, err)
+	}
+	if err := diskImage.SaveContainer(imageName, samfile.ContainerFor(imageName)); err != nil {
+		log.Fatal(err)
+	}
+}
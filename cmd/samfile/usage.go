@@ -7,43 +7,224 @@ Manipulate files in SAM Coupé floppy disk images.
 
   Usage:
     samfile add -i IMAGE -f FILE -c -l LOAD_ADDRESS [-e EXECUTION_ADDRESS]
+    samfile add -i IMAGE -f FILE --screen MODE
+    samfile add -i IMAGE -f FILE --array ARRAY
+    samfile add -i IMAGE -f FILE --snapshot
+    samfile add -i IMAGE -f FILE --basic [--start-line LINE]
+    samfile attrib -i IMAGE -f FILE [--hide|--unhide] [--protect|--unprotect]
     samfile basic-to-text [--lossy]
+    samfile basic-to-text --vars -i IMAGE -f FILE [--lossy]
     samfile text-to-basic
-    samfile cat -i IMAGE -f FILE
-    samfile extract -i IMAGE [-t TARGET]
-    samfile ls -i IMAGE
+    samfile build -i IMAGE -m MANIFEST
+    samfile cat -i IMAGE -f FILE [--format FORMAT]
+    samfile defrag -i IMAGE
+    samfile diff IMAGE_A IMAGE_B
+    samfile extract -i IMAGE [-t TARGET] [-f FILE]
+    samfile fsck -i IMAGE [--json] [--repair [--dry-run]]
+    samfile install-dos -i IMAGE [-f FILE]
+    samfile ls -i IMAGE [--format FORMAT]
+    samfile map -i IMAGE [-o OUTPUT]
+    samfile mv -i IMAGE -f FILE -n NEW_NAME
+    samfile new -i IMAGE [--label LABEL] [--dos DOSFILE]
+    samfile pack -i IMAGE -d DIR
+    samfile rm -i IMAGE -f FILE [--scrub]
+    samfile screen2png -i IMAGE -f FILE -o OUTPUT
+    samfile snapshot -i IMAGE -f FILE -o OUTPUT
+    samfile unpack -i IMAGE -d DIR
     samfile --help
     samfile --version
 
   Targets:
     add                   Adds a file from the host file system to the SAM Disk
-                          image file.
+                          image file. With --screen, FILE is a PNG image which
+                          is added as a SCREEN$ file named after FILE without
+                          its extension. With --array, FILE is a JSON or CSV
+                          file which is added as an array file (loadable with
+                          LOAD "name" DATA), likewise named. With
+                          --snapshot, FILE is a 48K ZX Spectrum snapshot
+                          which is added as a ZX snapshot file, likewise
+                          named. With --basic, FILE is SAM BASIC text which
+                          is tokenised and added as a SAM BASIC program,
+                          likewise named.
+    attrib                Shows or changes the HIDDEN / PROTECTED attributes of
+                          a single file in a SAM Disk image file. With no
+                          attribute options, prints the current attributes.
     basic-to-text         Read a SAM Basic encoded file from stdin and output
-                          plain text listing to stdout.
+                          plain text listing to stdout. With --vars, list
+                          FILE from IMAGE instead, followed by a blank line
+                          and the variables saved with it.
     text-to-basic         Read plain-text SAM BASIC source from stdin and
                           output the tokenised program body (suitable for
                           piping into 'samfile basic-to-text' to verify
                           the round-trip).
+    build                 Creates SAM Disk image file IMAGE (replacing any
+                          existing file) from JSON file MANIFEST, which
+                          lists the files to write, in order: an object
+                          with an optional "label", an optional "dos" file
+                          to install and "files", an array of objects with
+                          the "source" file (relative to MANIFEST), its
+                          "type" ("code", "basic", "screen", "array" or
+                          "snapshot"), an optional SAM "name" and
+                          "attributes" (["HIDDEN", "PROTECTED"]), and
+                          "load" and "exec" addresses (code), "start_line"
+                          (basic), "mode" (screen) or "array" name (array).
     cat                   Output a single file from a SAM Disk image file to
-                          stdout.
-    extract               Extracts all files from a SAM Disk image file to a
-                          local directory.
+                          stdout. If FILE is a pattern matching several
+                          files, they are output one after another. With
+                          --format, array files (saved with SAVE ... DATA)
+                          are decoded instead of output raw.
+    defrag                Rewrites every file in a SAM Disk image file into
+                          contiguous sectors, in directory order, leaving a
+                          single contiguous region of free space. A DOS at
+                          track 4 sector 1 stays there, so a bootable image
+                          still boots.
+    diff                  Compares the files of SAM Disk image files IMAGE_A
+                          and IMAGE_B, pairing them by name, and lists the
+                          files added, removed, renamed (same contents,
+                          different name) or changed: their type, start
+                          address, execution address, start line or
+                          attributes, and their contents, as a line by line
+                          diff of the listings of SAM BASIC programs. Exits
+                          non-zero if the images' files differ.
+    extract               Extracts all files (or, with -f, the files matching
+                          FILE) from a SAM Disk image file to a local
+                          directory.
+    fsck                  Checks the directory of a SAM Disk image file for
+                          inconsistencies (broken or looping sector chains,
+                          cross-linked sectors, bad sector counts, directory
+                          fields that disagree with file headers). Exits
+                          non-zero if any problems are found. With --repair,
+                          first fixes what can be fixed mechanically and
+                          lists every change made; add --dry-run to list
+                          the changes without saving them.
+    install-dos           Installs a DOS file such as samdos2 as the first file
+                          on a SAM Disk image file (directory slot 0, track 4
+                          sector 1), moving aside any file already there, so
+                          the SAM ROM's BOOT command loads it. Without -f,
+                          just reports whether the image is bootable. Exits
+                          non-zero if it is not.
     ls                    Lists files on SAM Disk image file.
+    map                   Shows which file owns each of the 1560 data sectors
+                          of a SAM Disk image file, which sectors are free or
+                          cross-linked and where the directory is, followed
+                          by the free space and the number of fragments of
+                          each file. With -o, draws the map as a PNG or SVG
+                          image instead, as chosen by the extension of
+                          OUTPUT.
+    mv                    Renames a single file inside a SAM Disk image file,
+                          leaving its contents and location unchanged.
+    new                   Creates a new, empty SAM Disk image file, optionally
+                          labelled and made bootable. The image format is
+                          chosen from the file extension (.mgt, .dsk, .sad,
+                          optionally followed by .gz, or a .zip archive).
+    pack                  Creates a new SAM Disk image file from a directory
+                          written by unpack, byte for byte identical to the
+                          image that was unpacked.
+    rm                    Deletes a single file from a SAM Disk image file,
+                          freeing its directory slot and sectors.
+    screen2png            Converts a SCREEN$ file in a SAM Disk image file to
+                          a PNG image, in the colours of the palette saved
+                          with it. MODE 3 screens are 512×192 pixels, others
+                          256×192.
+    snapshot              Converts a ZX snapshot file in a SAM Disk image file
+                          to a ZX Spectrum emulator snapshot: a .sna file or
+                          a (version 1) .z80 file, as chosen by the extension
+                          of OUTPUT.
+    unpack                Writes every file of a SAM Disk image file to
+                          directory DIR, together with a manifest.json
+                          recording every directory entry field, the exact
+                          sector chain of each file and any other bytes on
+                          the disk, so that pack can rebuild the image.
 
   Options:
     -i IMAGE              The raw floppy disk image (.mgt format / 819200 bytes)
+                          or an Extended CPC DSK (EDSK) or SimCoupé SAD image,
+                          optionally gzip compressed or inside a zip archive
+                          (use ARCHIVE.zip:NAME to choose one of several
+                          images in an archive). Modified images are written
+                          back in the format they were read in.
                           On linux a floppy disk image can be created by running
                             dd if=/dev/fd0u800 of=image.mgt conv=noerror,sync
                           If /dev/fd0u800 does not exist it can be created with
                             sudo mknod /dev/fd0u800 b 2 120
+    -o OUTPUT             (map, screen2png, snapshot) The PNG, SVG, .sna or
+                          .z80 file to write.
+    -m MANIFEST           (build) The JSON file describing the image to build.
+    -d DIR                (pack, unpack) The directory holding the unpacked
+                          files and manifest.
     -t TARGET             An existing directory to write all files to. Defaults
                           to current directory.
-    -f FILE               A single file inside the disk image.
+    -f FILE               A single file inside the disk image. As with SAMDOS,
+                          names are not case sensitive. For cat and extract,
+                          FILE may also be a pattern in which '*' matches any
+                          run of characters and '?' matches any single
+                          character; for basic-to-text --vars, screen2png
+                          and snapshot it may be a pattern that matches
+                          exactly one file. For install-dos, FILE is
+                          instead the DOS file on the host file system to
+                          install, which must carry the "BOOT" signature
+                          the SAM ROM checks for.
+    -n NEW_NAME           (mv) The new name for FILE (at most 10 characters).
     -c                    File is a code file.
     -l LOAD_ADDRESS       Load address of code file on the SAM Disk image.
     -e EXECUTION_ADDRESS  Execution address of code file on the SAM Disk image.
+    --format FORMAT       (cat) Output array files as "json" (an object with
+                          the array name, type, dimensions and nested
+                          values) or "csv" (one row per run of the last
+                          dimension).
+                          (ls) Output the directory as "json", "csv" or
+                          "table", one row per file with its slot, type,
+                          attributes, sectors, addresses and lengths, and
+                          array name or screen mode.
+    --screen MODE         (add) Convert FILE to a SCREEN$ file for screen mode
+                          MODE (1-4), mapping its colours to the SAM palette.
+                          The image must be 512×192 pixels for MODE 3 and
+                          256×192 otherwise, and use at most 4 colours in
+                          MODE 3, 16 in MODE 4, or (in MODES 1 and 2) 2 per
+                          attribute cell.
+    --array ARRAY         (add) Convert FILE to an array file holding SAM BASIC
+                          array ARRAY (a string array if ARRAY ends in '$').
+                          A .csv FILE holds one value per line, or one row
+                          of a two-dimensional array per line. Otherwise FILE
+                          is JSON: nested lists of values, or the object
+                          written by 'samfile cat --format json'. Strings
+                          are padded with spaces to the longest (or to the
+                          last of the object's dimensions).
+    --snapshot            (add) Convert FILE, a 48K .sna or version 1 .z80
+                          snapshot, to a ZX snapshot file. The snapshot's
+                          stack must have room for 6 bytes of registers.
+    --basic               (add) Tokenise FILE, plain-text SAM BASIC as read by
+                          text-to-basic, into a SAM BASIC program. Syntax
+                          errors are reported as FILE:LINE:COLUMN.
+    --start-line LINE     (add --basic) Make the program auto-RUN from line
+                          LINE when loaded.
+    --scrub               (rm) Also overwrite the deleted file's sectors with
+                          zeros so its contents cannot be recovered.
+    --hide                (attrib) Set the HIDDEN attribute.
+    --unhide              (attrib) Clear the HIDDEN attribute.
+    --protect             (attrib) Set the PROTECTED attribute.
+    --unprotect           (attrib) Clear the PROTECTED attribute.
+    --json                (fsck) Report problems as a JSON array (with --repair,
+                          an object with "repairs" and "problems" arrays).
+    --repair              (fsck) Truncate broken sector chains, rebuild sector
+                          maps and sector counts from the chains, re-sync
+                          directory fields from file headers, and save.
+    --dry-run             (fsck --repair) List the repairs that would be made,
+                          and the problems that would remain, without saving
+                          the disk image.
+    --label LABEL         (new) A disk label of at most 10 characters, stored
+                          where MasterDOS keeps it.
+    --dos DOSFILE         (new) A DOS file such as samdos2 to install as the
+                          first file on the disk, so that it boots. It must
+                          carry the "BOOT" signature the SAM ROM checks for.
     --help                Display this help text.
     --version             Display the release version of samfile.
+    --vars                (basic-to-text) Also print the program's saved
+                          variables, one per line: numbers as name=value
+                          (with the limit, step and loop line of FOR loop
+                          control variables), strings as name$="value", and
+                          arrays as DIM name(dimensions)= their values as
+                          nested JSON lists.
     --lossy               (basic-to-text) Emit the byte-for-byte
                           equivalent of the SAM ROM's LLIST routine
                           (matches stream 3 / printer output). Filters
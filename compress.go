@@ -0,0 +1,257 @@
+package samfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+// maxImageSize caps how much is read from a compressed archive entry,
+// comfortably above the largest supported container (a 2-sided
+// 80-track EDSK image is under 1MB) but low enough to stop a
+// decompression bomb.
+const maxImageSize = 8 << 20
+
+// imageExtensions are the filename extensions recognised as disk
+// images when choosing an entry from a zip archive.
+var imageExtensions = []string{".mgt", ".dsk", ".edsk", ".sad", ".img"}
+
+// splitArchivePath splits a filename of the form "ARCHIVE.zip:ENTRY"
+// into the archive path and the name of the entry inside it. If
+// filename names an existing file, or has no such suffix, entry is "".
+func splitArchivePath(filename string) (archive, entry string) {
+	if _, err := os.Stat(filename); err == nil {
+		return filename, ""
+	}
+	i := strings.LastIndex(filename, ":")
+	if i <= 0 {
+		return filename, ""
+	}
+	if _, err := os.Stat(filename[:i]); err != nil {
+		return filename, ""
+	}
+	return filename[:i], filename[i+1:]
+}
+
+// decodeCompressed unwraps a gzip stream or zip archive around a disk
+// image and decodes the image inside. For zip archives, entry selects
+// the archive member; if entry is "" the archive must contain exactly
+// one disk image (see zipImageEntry). Uncompressed data is passed
+// straight to decodeImage.
+func decodeCompressed(data []byte, entry string) (*DiskImage, *Container, error) {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, fmt.Errorf("bad gzip data: %v", err)
+		}
+		image, err := readImage(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("bad gzip data: %v", err)
+		}
+		di, container, err := decodeImage(image)
+		if err != nil {
+			return nil, nil, err
+		}
+		container.Compression = COMPRESSION_GZIP
+		return di, container, nil
+	case bytes.HasPrefix(data, zipMagic):
+		r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, nil, fmt.Errorf("bad zip archive: %v", err)
+		}
+		f, err := zipImageEntry(r, entry)
+		if err != nil {
+			return nil, nil, err
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, nil, fmt.Errorf("can't read %q from zip archive: %v", f.Name, err)
+		}
+		defer rc.Close()
+		image, err := readImage(rc)
+		if err != nil {
+			return nil, nil, fmt.Errorf("can't read %q from zip archive: %v", f.Name, err)
+		}
+		di, container, err := decodeImage(image)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%q in zip archive: %v", f.Name, err)
+		}
+		container.Compression = COMPRESSION_ZIP
+		container.ZipEntry = f.Name
+		return di, container, nil
+	}
+	if entry != "" {
+		return nil, nil, fmt.Errorf("not a zip archive, so can't select entry %q", entry)
+	}
+	return decodeImage(data)
+}
+
+// readImage reads all of r, up to maxImageSize bytes.
+func readImage(r io.Reader) ([]byte, error) {
+	image, err := io.ReadAll(io.LimitReader(r, maxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(image) > maxImageSize {
+		return nil, fmt.Errorf("uncompressed image is larger than %v bytes", maxImageSize)
+	}
+	return image, nil
+}
+
+// zipImageEntry returns the archive member named entry or, if entry is
+// "", the single disk image in the archive: the only file, or else the
+// only file with a disk image extension (see imageExtensions).
+func zipImageEntry(r *zip.Reader, entry string) (*zip.File, error) {
+	files := []*zip.File{}
+	candidates := []*zip.File{}
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if entry != "" && f.Name == entry {
+			return f, nil
+		}
+		files = append(files, f)
+		if hasImageExtension(f.Name) {
+			candidates = append(candidates, f)
+		}
+	}
+	switch {
+	case entry != "":
+		return nil, fmt.Errorf("zip archive has no entry %q", entry)
+	case len(files) == 1:
+		return files[0], nil
+	case len(candidates) == 1:
+		return candidates[0], nil
+	}
+	names := []string{}
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	return nil, fmt.Errorf("zip archive holds %v files (%v); choose one with ARCHIVE.zip:NAME", len(files), strings.Join(names, ", "))
+}
+
+// gzipBytes returns data compressed as a gzip stream.
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeZipEntry writes data as member entry of zip archive filename.
+// If the archive already exists, every other member is copied across
+// unchanged and entry is replaced in place (or appended if absent);
+// otherwise a new archive holding just entry is created.
+func writeZipEntry(filename, entry string, data []byte) error {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	written := false
+	writeEntry := func(header *zip.FileHeader) error {
+		header.Extra = nil
+		header.Modified = time.Now()
+		fw, err := w.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(data)
+		written = true
+		return err
+	}
+	if existing, err := os.ReadFile(filename); err == nil {
+		r, err := zip.NewReader(bytes.NewReader(existing), int64(len(existing)))
+		if err != nil {
+			return fmt.Errorf("bad zip archive: %v", err)
+		}
+		if err := w.SetComment(r.Comment); err != nil {
+			return err
+		}
+		for _, f := range r.File {
+			if f.Name == entry {
+				header := f.FileHeader
+				err = writeEntry(&header)
+			} else {
+				err = w.Copy(f)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if !written {
+		if err := writeEntry(&zip.FileHeader{Name: entry, Method: zip.Deflate}); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, buf.Bytes(), 0600)
+}
+
+// ContainerFor returns the Container to use when writing a new disk
+// image to filename, chosen from its extension: ".dsk" and ".edsk" are
+// written as EDSK, ".sad" as SAD and anything else as raw MGT. A
+// ".gz" suffix adds gzip compression (so "disk.sad.gz" is a gzipped
+// SAD image). A ".zip" archive holds the image as member NAME when
+// filename is given as "ARCHIVE.zip:NAME", or else as the archive's
+// base name with ".zip" replaced by ".mgt"; the member's own extension
+// then chooses the format.
+func ContainerFor(filename string) *Container {
+	container := &Container{Format: FORMAT_MGT}
+	name := filename
+	lower := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(lower, ".gz"):
+		container.Compression = COMPRESSION_GZIP
+		name = filename[:len(filename)-len(".gz")]
+	case strings.HasSuffix(lower, ".zip"):
+		container.Compression = COMPRESSION_ZIP
+		base := path.Base(strings.ReplaceAll(filename, "\\", "/"))
+		name = base[:len(base)-len(".zip")]
+		if !hasImageExtension(name) {
+			name += ".mgt"
+		}
+		container.ZipEntry = name
+	case strings.Contains(lower, ".zip:"):
+		container.Compression = COMPRESSION_ZIP
+		name = filename[strings.LastIndex(lower, ".zip:")+len(".zip:"):]
+		container.ZipEntry = name
+	}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".dsk", ".edsk":
+		container.Format = FORMAT_EDSK
+	case ".sad":
+		container.Format = FORMAT_SAD
+	}
+	return container
+}
+
+// hasImageExtension reports whether name ends in one of
+// imageExtensions.
+func hasImageExtension(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	for _, imageExt := range imageExtensions {
+		if ext == imageExt {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package samfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testImage(t *testing.T) *DiskImage {
+	di, err := Load(filepath.Join("testdata", "ETrackerv1.2.mgt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return di
+}
+
+func TestGzipImage(t *testing.T) {
+	di := testImage(t)
+	filename := filepath.Join(t.TempDir(), "image.sad.gz")
+	if err := di.SaveContainer(filename, &Container{Format: FORMAT_SAD, Compression: COMPRESSION_GZIP}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, gzipMagic) {
+		t.Fatalf("saved image is not gzip compressed")
+	}
+	loaded, container, err := LoadContainer(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if container.Format != FORMAT_SAD || container.Compression != COMPRESSION_GZIP {
+		t.Errorf("expected gzip-compressed SAD container, got %v / %v", container.Format, container.Compression)
+	}
+	if *loaded != *di {
+		t.Errorf("gzip round trip changed the image")
+	}
+}
+
+func writeZip(t *testing.T, filename string, members map[string][]byte, order []string) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range order {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write(members[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestZipImage(t *testing.T) {
+	di := testImage(t)
+	filename := filepath.Join(t.TempDir(), "archive.zip")
+	writeZip(t, filename, map[string][]byte{
+		"README.TXT":    []byte("hello"),
+		"disk/ONE.MGT":  di[:],
+		"disk/TWO.MGT":  NewDiskImage()[:],
+		"disk/NOTE.TXT": []byte("note"),
+	}, []string{"README.TXT", "disk/ONE.MGT", "disk/TWO.MGT", "disk/NOTE.TXT"})
+
+	if _, _, err := LoadContainer(filename); err == nil {
+		t.Fatalf("expected error loading archive with two disk images and no entry name")
+	}
+	loaded, container, err := LoadContainer(filename + ":disk/ONE.MGT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if container.Compression != COMPRESSION_ZIP || container.ZipEntry != "disk/ONE.MGT" || *loaded != *di {
+		t.Fatalf("unexpected container %+v", container)
+	}
+	if err := loaded.DeleteFile("ENOLA_G .M", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.SaveContainer(filename+":disk/ONE.MGT", container); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	names := []string{}
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	if len(names) != 4 || names[1] != "disk/ONE.MGT" || names[3] != "disk/NOTE.TXT" {
+		t.Fatalf("archive members changed: %v", names)
+	}
+	reloaded, _, err := LoadContainer(filename + ":disk/ONE.MGT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *reloaded != *loaded {
+		t.Errorf("modified image was not saved back into the zip archive")
+	}
+}
+
+func TestZipWithSingleImage(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "archive.zip")
+	writeZip(t, filename, map[string][]byte{
+		"README.TXT": []byte("hello"),
+		"GAME.DSK":   testImage(t).EDSK(),
+	}, []string{"README.TXT", "GAME.DSK"})
+	_, container, err := LoadContainer(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if container.ZipEntry != "GAME.DSK" || container.Format != FORMAT_EDSK {
+		t.Errorf("expected EDSK image GAME.DSK to be chosen, got %+v", container)
+	}
+}
+
+func TestContainerFor(t *testing.T) {
+	for filename, expected := range map[string]Container{
+		"disk.mgt":           {Format: FORMAT_MGT},
+		"disk.DSK":           {Format: FORMAT_EDSK},
+		"disk.sad.gz":        {Format: FORMAT_SAD, Compression: COMPRESSION_GZIP},
+		"dir/disks.zip":      {Format: FORMAT_MGT, Compression: COMPRESSION_ZIP, ZipEntry: "disks.mgt"},
+		"disk.edsk.zip":      {Format: FORMAT_EDSK, Compression: COMPRESSION_ZIP, ZipEntry: "disk.edsk"},
+		"disks.zip:game.sad": {Format: FORMAT_SAD, Compression: COMPRESSION_ZIP, ZipEntry: "game.sad"},
+	} {
+		if container := ContainerFor(filename); *container != expected {
+			t.Errorf("%v: expected %+v, got %+v", filename, expected, *container)
+		}
+	}
+}
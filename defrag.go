@@ -0,0 +1,90 @@
+package samfile
+
+import (
+	"fmt"
+)
+
+// Defragment rewrites every used file into contiguous data sectors, in
+// directory slot order apart from any boot file (see below), so that
+// each file's sector chain is a single run and all remaining free
+// space is one contiguous region at the end of the data area. Sectors
+// are allocated in SectorAddressMap bit order (track 4 side 0 upwards,
+// then side 1), the same order SAMDOS and AddCodeFile allocate in.
+//
+// Each file's 510-byte sector payloads are copied verbatim; only the
+// chain links (bytes 510–511), the directory entry's FirstSector and
+// SectorAddressMap, and (if it disagreed) Sectors are rewritten.
+// Sectors left free afterwards keep their contents, so erased files
+// stay as recoverable as they were, as far as they weren't written
+// over.
+//
+// A bootable disk stays bootable: the file starting at track 4 sector
+// 1, normally the DOS (see InstallDOS), is written first, whatever its
+// slot, so that it keeps its place there.
+//
+// Returns an error, leaving the image untouched, if any file's sector
+// chain is broken, if two files' chains or sector address maps share
+// a sector (see Check and Repair), or if the disk is bootable but its
+// boot sector isn't the first sector of a file, so would move.
+func (di *DiskImage) Defragment() error {
+	dj := di.DiskJournal()
+	chains := map[int][]*Sector{}
+	order := []int{}
+	owners := map[Sector]int{}
+	for _, slot := range dj.UsedFileEntries() {
+		chain, kind, description := di.sectorChain(dj[slot].FirstSector)
+		if kind != "" {
+			return fmt.Errorf("cannot defragment disk: file %q has a broken sector chain (%v: %v); run fsck --repair first", dj[slot].Name.String(), kind, description)
+		}
+		// A sector in two chains would be written once for each,
+		// which may not even fit on the disk.
+		for _, sector := range chain {
+			if other, ok := owners[*sector]; ok {
+				return fmt.Errorf("cannot defragment disk: files %q and %q share %v in their sector chains; fix this by hand first", dj[other].Name.String(), dj[slot].Name.String(), sector)
+			}
+			owners[*sector] = slot
+		}
+		chains[slot] = chain
+		if *chain[0] == *bootSector {
+			order = append([]int{slot}, order...)
+		} else {
+			order = append(order, slot)
+		}
+	}
+	for _, problem := range di.Check() {
+		if problem.Kind == PK_CROSS_LINKED {
+			return fmt.Errorf("cannot defragment disk: file %q is cross-linked (%v); fix this by hand first", problem.Name, problem.Description)
+		}
+	}
+	bootable := di.Bootable() == nil
+	old := *di
+	dataSectors := (&SectorAddressMap{}).FreeSectors()
+	next := 0
+	for _, slot := range order {
+		fe := dj[slot]
+		chain := chains[slot]
+		fe.FirstSector = dataSectors[next]
+		fe.Sectors = uint16(len(chain))
+		fe.SectorAddressMap = &SectorAddressMap{}
+		for i, sector := range chain {
+			sd, _ := old.SectorData(sector)
+			if i < len(chain)-1 {
+				sd[510] = dataSectors[next+1].Track
+				sd[511] = dataSectors[next+1].Sector
+			} else {
+				sd[510] = 0
+				sd[511] = 0
+			}
+			offset, mask := dataSectors[next].SAMMask()
+			fe.SectorAddressMap[offset] |= mask
+			di.WriteSector(dataSectors[next], sd)
+			next++
+		}
+		di.WriteFileEntry(dj, slot)
+	}
+	if bootable && di.Bootable() != nil {
+		*di = old
+		return fmt.Errorf("cannot defragment disk: %v is not the first sector of a file, so the disk would no longer boot", bootSector)
+	}
+	return nil
+}
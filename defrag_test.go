@@ -0,0 +1,152 @@
+package samfile
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDefragment(t *testing.T) {
+	di := NewDiskImage()
+	bodies := map[string][]byte{}
+	for i, name := range []string{"A", "B", "C", "D"} {
+		bodies[name] = bytes.Repeat([]byte{byte(i + 1)}, 1000*(i+1))
+		if err := di.AddCodeFile(name, bodies[name], 0x8000, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Deleting A and C and re-adding C leaves C fragmented across A's
+	// old sectors and the free space after D.
+	for _, name := range []string{"A", "C"} {
+		if err := di.DeleteFile(name, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := di.AddCodeFile("C", bodies["C"], 0x8000, 0); err != nil {
+		t.Fatal(err)
+	}
+	delete(bodies, "A")
+
+	if err := di.Defragment(); err != nil {
+		t.Fatal(err)
+	}
+	if problems := di.Check(); len(problems) != 0 {
+		t.Fatalf("defragmented image has problems: %v", problems)
+	}
+	next := 0
+	all := (&SectorAddressMap{}).FreeSectors()
+	dj := di.DiskJournal()
+	for _, slot := range dj.UsedFileEntries() {
+		for _, sector := range dj[slot].SectorAddressMap.UsedSectors() {
+			if *sector != *all[next] {
+				t.Fatalf("slot %v: expected %v, got %v", slot, all[next], sector)
+			}
+			next++
+		}
+	}
+	if free := dj.CombinedSectorMap().FreeSectors(); len(free) != len(all)-next || *free[0] != *all[next] {
+		t.Errorf("free space is not a single contiguous region")
+	}
+	for name, body := range bodies {
+		f, err := di.File(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(f.Body, body) {
+			t.Errorf("file %q body changed by Defragment", name)
+		}
+	}
+}
+
+func TestDefragmentKeepsBootFile(t *testing.T) {
+	di := NewDiskImage()
+	if err := di.InstallDOS("samdos2", testDOS(10000)); err != nil {
+		t.Fatal(err)
+	}
+	bodies := map[string][]byte{"samdos2": testDOS(10000)}
+	for i, name := range []string{"A", "B", "C"} {
+		bodies[name] = bytes.Repeat([]byte{byte(i + 1)}, 1000*(i+1))
+		if err := di.AddCodeFile(name, bodies[name], 0x8000, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := di.DeleteFile("A", false); err != nil {
+		t.Fatal(err)
+	}
+	delete(bodies, "A")
+	// Swap the DOS into slot 2, after B, so that slot order alone would
+	// move B to track 4 sector 1.
+	dj := di.DiskJournal()
+	dj[0], dj[2] = dj[2], dj[0]
+	di.WriteFileEntry(dj, 0)
+	di.WriteFileEntry(dj, 2)
+
+	if err := di.Defragment(); err != nil {
+		t.Fatal(err)
+	}
+	if err := di.Bootable(); err != nil {
+		t.Fatalf("disk no longer boots after Defragment: %v", err)
+	}
+	if fe := di.DiskJournal()[2]; fe.Name.String() != "samdos2" || *fe.FirstSector != *bootSector {
+		t.Errorf("expected samdos2 in slot 2 to start at %v, got %v at %v", bootSector, fe.Name, fe.FirstSector)
+	}
+	if problems := di.Check(); len(problems) != 0 {
+		t.Fatalf("defragmented image has problems: %v", problems)
+	}
+	if m := di.Map(); m.Files[0].Fragments != 1 || m.Files[1].Fragments != 1 || m.Files[2].Fragments != 1 {
+		t.Errorf("expected every file to be a single run after Defragment")
+	}
+	for name, body := range bodies {
+		f, err := di.File(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(f.Body, body) {
+			t.Errorf("file %q body changed by Defragment", name)
+		}
+	}
+}
+
+func TestDefragmentRefusesCrossLinkedChains(t *testing.T) {
+	di := NewDiskImage()
+	for _, file := range []struct {
+		name    string
+		sectors int
+	}{{"A", 700}, {"B", 500}} {
+		if err := di.AddCodeFile(file.name, make([]byte, file.sectors*510-9), 0x8000, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Link B's last sector into the middle of A's chain.
+	dj := di.DiskJournal()
+	chainA, _, _ := di.sectorChain(dj[0].FirstSector)
+	chainB, _, _ := di.sectorChain(dj[1].FirstSector)
+	last := chainB[len(chainB)-1].Offset()
+	di[last+510] = chainA[100].Track
+	di[last+511] = chainA[100].Sector
+	before := *di
+	if err := di.Defragment(); err == nil {
+		t.Fatalf("expected an error defragmenting cross-linked chains")
+	}
+	if *di != before {
+		t.Errorf("failed Defragment changed the image")
+	}
+}
+
+func TestDefragmentLeavesFreeSectors(t *testing.T) {
+	di := NewDiskImage()
+	for i, name := range []string{"A", "B"} {
+		if err := di.AddCodeFile(name, bytes.Repeat([]byte{byte(i + 1)}, 2000), 0x8000, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	erased := di.DiskJournal()[1].FirstSector
+	if err := di.DeleteFile("B", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := di.Defragment(); err != nil {
+		t.Fatal(err)
+	}
+	if sd, _ := di.SectorData(erased); sd[100] != 2 {
+		t.Errorf("expected the erased file's sectors to be left as they were")
+	}
+}
@@ -0,0 +1,322 @@
+package samfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type (
+	// ChangeKind classifies a FileChange reported by Diff. The values
+	// are short, stable, lowercase identifiers; see the CK_*
+	// constants.
+	ChangeKind string
+
+	// FileChange is one difference between the files of two disk
+	// images found by Diff.
+	FileChange struct {
+		Kind ChangeKind
+		// Name is the file's name on the first disk, or on the
+		// second disk for an added file.
+		Name string
+		// NewName is the file's name on the second disk, for a
+		// renamed file.
+		NewName string
+		// Metadata describes each directory field that differs, as
+		// "field: old -> new".
+		Metadata []string
+		// Body describes how the file bodies differ: for SAM BASIC
+		// programs, the listing lines removed ("- ") and added
+		// ("+ "); for other files, a summary of the bytes that
+		// differ.
+		Body []string
+	}
+
+	// diffFile is a file of one side of a Diff.
+	diffFile struct {
+		entry *ListEntry
+		fe    *FileEntry
+		body  []byte
+		hash  [sha256.Size]byte
+		// snapshot is set for FT_ZX_SNAPSHOT files, whose registers
+		// are kept in the directory entry.
+		snapshot *Snapshot
+	}
+)
+
+// Kinds of FileChange reported by Diff.
+const (
+	// The file is only on the second disk.
+	CK_ADDED = ChangeKind("added")
+	// The file is only on the first disk.
+	CK_REMOVED = ChangeKind("removed")
+	// The file has a different name on each disk but the same body.
+	CK_RENAMED = ChangeKind("renamed")
+	// The file has the same name on both disks but different
+	// directory fields or body.
+	CK_CHANGED = ChangeKind("changed")
+)
+
+// String returns "kind: NAME" (or "renamed: OLD -> NEW") followed by
+// an indented line for each metadata and body difference.
+func (c *FileChange) String() string {
+	text := fmt.Sprintf("%v: %v", c.Kind, c.Name)
+	if c.Kind == CK_RENAMED {
+		text += " -> " + c.NewName
+	}
+	for _, line := range append(append([]string{}, c.Metadata...), c.Body...) {
+		text += "\n  " + line
+	}
+	return text
+}
+
+// Diff compares the files of disk images a and b. Files are paired by
+// name, case-insensitively as SAMDOS compares them; a file only on a
+// and a file only on b with identical bodies are reported as a rename.
+// Files on both disks are compared field by field (type, start
+// address, execution address, auto-RUN line and attributes) and body
+// by body; SAM BASIC programs are compared as detokenised listings,
+// line by line. Changes are returned with removed and renamed files in
+// a's slot order, then changed files, then added files in b's slot
+// order. The body of a file with a broken sector chain is compared as
+// far as the chain is valid.
+func Diff(a, b *DiskImage) []*FileChange {
+	filesA := a.diffFiles()
+	filesB := b.diffFiles()
+	byName := map[string]*diffFile{}
+	for _, f := range filesB {
+		byName[strings.ToUpper(f.entry.Name)] = f
+	}
+	paired := map[*diffFile]bool{}
+	removed := []*diffFile{}
+	changes := []*FileChange{}
+	for _, fa := range filesA {
+		fb := byName[strings.ToUpper(fa.entry.Name)]
+		if fb == nil || paired[fb] {
+			removed = append(removed, fa)
+			continue
+		}
+		paired[fb] = true
+		if change := compareFiles(fa, fb); change != nil {
+			changes = append(changes, change)
+		}
+	}
+	result := []*FileChange{}
+	for _, fa := range removed {
+		change := &FileChange{Kind: CK_REMOVED, Name: fa.entry.Name}
+		for _, fb := range filesB {
+			if !paired[fb] && fb.hash == fa.hash {
+				paired[fb] = true
+				change.Kind = CK_RENAMED
+				change.NewName = fb.entry.Name
+				change.Metadata = compareMetadata(fa.entry, fb.entry)
+				break
+			}
+		}
+		result = append(result, change)
+	}
+	result = append(result, changes...)
+	for _, fb := range filesB {
+		if !paired[fb] {
+			result = append(result, &FileChange{Kind: CK_ADDED, Name: fb.entry.Name})
+		}
+	}
+	return result
+}
+
+// diffFiles reads every used file of di for Diff.
+func (di *DiskImage) diffFiles() []*diffFile {
+	dj := di.DiskJournal()
+	files := []*diffFile{}
+	for _, entry := range dj.List() {
+		fe := dj[entry.Slot]
+		f := &diffFile{
+			entry: entry,
+			fe:    fe,
+		}
+		if fe.Type == FT_ZX_SNAPSHOT {
+			if s, err := di.ReadSnapshot(fe); err == nil {
+				f.snapshot = s
+				f.body = s.RAM[:]
+			} else {
+				f.body = di.partialBody(fe, 0)
+			}
+		} else {
+			if file, err := di.ReadFile(fe); err == nil {
+				f.body = file.Body
+			} else {
+				f.body = di.partialBody(fe, 9)
+			}
+		}
+		f.hash = sha256.Sum256(f.body)
+		files = append(files, f)
+	}
+	return files
+}
+
+// partialBody returns as much of the body of fe, after its
+// headerLength byte header, as its sector chain holds up to the first
+// invalid link, for a file whose chain is broken.
+func (di *DiskImage) partialBody(fe *FileEntry, headerLength int) []byte {
+	chain, _, _ := di.sectorChain(fe.FirstSector)
+	raw := []byte{}
+	for _, sector := range chain {
+		sectorData, _ := di.SectorData(sector)
+		raw = append(raw, sectorData.FilePart().Data[:]...)
+	}
+	if len(raw) < headerLength {
+		return nil
+	}
+	return raw[headerLength:]
+}
+
+// compareFiles returns the differences between fa and fb, which have
+// the same name, or nil if there are none.
+func compareFiles(fa, fb *diffFile) *FileChange {
+	change := &FileChange{
+		Kind:     CK_CHANGED,
+		Name:     fa.entry.Name,
+		Metadata: compareMetadata(fa.entry, fb.entry),
+	}
+	if fa.snapshot != nil && fb.snapshot != nil {
+		registersA, registersB := *fa.snapshot, *fb.snapshot
+		registersA.RAM, registersB.RAM = [SnapshotLength]byte{}, [SnapshotLength]byte{}
+		if registersA != registersB {
+			change.Metadata = append(change.Metadata, "registers differ")
+		}
+	}
+	if fa.hash != fb.hash {
+		change.Body = compareBodies(fa, fb)
+	}
+	if len(change.Metadata) == 0 && len(change.Body) == 0 {
+		return nil
+	}
+	return change
+}
+
+// compareMetadata describes the directory fields that differ between
+// a and b.
+func compareMetadata(a, b *ListEntry) []string {
+	differences := []string{}
+	compare := func(field string, old, new any) {
+		if !reflect.DeepEqual(old, new) {
+			differences = append(differences, fmt.Sprintf("%v: %v -> %v", field, old, new))
+		}
+	}
+	compare("type", a.Type, b.Type)
+	compare("start address", a.Start, b.Start)
+	compare("execution address", orNone(a.ExecutionAddress), orNone(b.ExecutionAddress))
+	compare("start line", orNone(a.StartLine), orNone(b.StartLine))
+	compare("attributes", attributeList(a.Attributes), attributeList(b.Attributes))
+	return differences
+}
+
+// orNone returns the value p points to, or "none" if p is nil.
+func orNone[T any](p *T) any {
+	if p == nil {
+		return "none"
+	}
+	return *p
+}
+
+// attributeList returns attributes as a comma separated list, or "-"
+// if empty, as FileAttributes.String does.
+func attributeList(attributes []string) string {
+	if len(attributes) == 0 {
+		return "-"
+	}
+	return strings.Join(attributes, ", ")
+}
+
+// compareBodies describes how the bodies of fa and fb differ.
+func compareBodies(fa, fb *diffFile) []string {
+	if fa.fe.Type == FT_SAM_BASIC && fb.fe.Type == FT_SAM_BASIC {
+		listingA, errA := basicListing(fa.body)
+		listingB, errB := basicListing(fb.body)
+		if errA == nil && errB == nil {
+			if lines := diffLines(listingA, listingB); len(lines) > 0 {
+				return lines
+			}
+			return []string{"listing unchanged; " + compareBytes(fa.body, fb.body)}
+		}
+	}
+	return []string{compareBytes(fa.body, fb.body)}
+}
+
+// basicListing returns the detokenised listing of SAM BASIC body
+// body, one line per element.
+func basicListing(body []byte) ([]string, error) {
+	var listing bytes.Buffer
+	if err := NewSAMBasic(body).WriteText(&listing); err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(listing.String(), "\n"), "\n"), nil
+}
+
+// compareBytes summarises the differences between bodies a and b.
+func compareBytes(a, b []byte) string {
+	differ, first := 0, -1
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			differ++
+			if first < 0 {
+				first = i
+			}
+		}
+	}
+	summary := ""
+	if len(a) != len(b) {
+		summary = fmt.Sprintf("length %v -> %v; ", len(a), len(b))
+		shorter, longer := len(a), len(b)
+		if shorter > longer {
+			shorter, longer = longer, shorter
+		}
+		differ += longer - shorter
+		if first < 0 {
+			first = shorter
+		}
+	}
+	return summary + fmt.Sprintf("%v byte(s) differ, the first at offset %v", differ, first)
+}
+
+// diffLines returns the lines of a not in b prefixed with "- " and the
+// lines of b not in a prefixed with "+ ", in order, based on a longest
+// common subsequence of the two.
+func diffLines(a, b []string) []string {
+	// common[i][j] is the length of the longest common subsequence
+	// of a[i:] and b[j:].
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = common[i+1][j]
+				if common[i][j+1] > common[i][j] {
+					common[i][j] = common[i][j+1]
+				}
+			}
+		}
+	}
+	lines := []string{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j == len(b) || (i < len(a) && common[i+1][j] >= common[i][j+1]):
+			lines = append(lines, "- "+a[i])
+			i++
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+	return lines
+}
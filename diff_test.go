@@ -0,0 +1,71 @@
+package samfile
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/petemoore/samfile/v3/sambasic"
+)
+
+func TestDiffIdentical(t *testing.T) {
+	if changes := Diff(testImage(t), testImage(t)); len(changes) != 0 {
+		t.Errorf("expected no changes but got %v", changes)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a, b := NewDiskImage(), NewDiskImage()
+	addBasic := func(di *DiskImage, name, source string) {
+		file, err := sambasic.ParseTextString(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.StartLine = 0xffff
+		if err := di.AddBasicFile(name, file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addCode := func(di *DiskImage, name string, data []byte, load, exec uint32) {
+		if err := di.AddCodeFile(name, data, load, exec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addBasic(a, "PROG", "10 PRINT \"A\"\n20 GO TO 10\n")
+	addBasic(b, "prog", "10 PRINT \"B\"\n20 GO TO 10\n30 STOP\n")
+	addCode(a, "CODE", []byte{1, 2, 3, 4}, 0x8000, 0)
+	addCode(b, "CODE", []byte{1, 9, 3, 4, 5}, 0x9000, 0x9000)
+	addCode(a, "OLD", []byte("same"), 0x8000, 0)
+	addCode(b, "NEW", []byte("same"), 0x8000, 0)
+	addCode(a, "GONE", []byte("gone"), 0x8000, 0)
+	addCode(b, "EXTRA", []byte("extra"), 0x8000, 0)
+	if err := b.SetFileAttributes("NEW", FA_PROTECTED); err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, change := range Diff(a, b) {
+		got = append(got, change.String())
+	}
+	want := []string{
+		"renamed: OLD -> NEW\n  attributes: - -> PROTECTED",
+		"removed: GONE",
+		"changed: PROG\n  -    10 PRINT \"A\"\n  +    10 PRINT \"B\"\n  +    30 STOP ",
+		"changed: CODE\n  start address: 32768 -> 36864\n  execution address: none -> 36864\n  length 4 -> 5; 2 byte(s) differ, the first at offset 1",
+		"added: EXTRA",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected changes\n%q\nbut got\n%q", want, got)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	got := diffLines([]string{"a", "b", "c", "d"}, []string{"a", "c", "e", "d"})
+	want := []string{"- b", "+ e"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+	if got := compareBytes([]byte{1, 2}, bytes.Repeat([]byte{1}, 2)); got != "1 byte(s) differ, the first at offset 1" {
+		t.Errorf("unexpected summary %q", got)
+	}
+}
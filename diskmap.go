@@ -0,0 +1,281 @@
+package samfile
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+)
+
+// DataSectors is the number of data sectors on a disk: tracks 4–79 of
+// side 0 and tracks 0–79 (128–207) of side 1, 10 sectors each. These
+// are the sectors a SectorAddressMap has a bit for.
+const DataSectors = 1560
+
+// mapCellSize is the size in pixels of one sector of DiskMap.Image,
+// including its 1-pixel border.
+const mapCellSize = 8
+
+var (
+	mapFreeColour        = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	mapDirectoryColour   = color.RGBA{0x60, 0x60, 0x60, 0xff}
+	mapCrossLinkedColour = color.RGBA{0xff, 0x00, 0x00, 0xff}
+	mapBorderColour      = color.RGBA{0xc0, 0xc0, 0xc0, 0xff}
+
+	// mapSlotColours are the colours of owned sectors, used in turn
+	// by consecutive slots so that neighbouring files contrast.
+	mapSlotColours = []color.RGBA{
+		{0x1f, 0x77, 0xb4, 0xff},
+		{0xff, 0x9f, 0x0e, 0xff},
+		{0x2c, 0xa0, 0x2c, 0xff},
+		{0x94, 0x67, 0xbd, 0xff},
+		{0x8c, 0x56, 0x4b, 0xff},
+		{0xe3, 0x77, 0xc2, 0xff},
+		{0x7f, 0x7f, 0x00, 0xff},
+		{0x17, 0xbe, 0xcf, 0xff},
+	}
+)
+
+// DiskMap describes how the data sectors of a disk are allocated.
+type DiskMap struct {
+	// Owners holds, for each data sector in SectorAddressMap bit
+	// order (see DataSector), the slots whose sector address maps
+	// claim it: none for a free sector, more than one for a
+	// cross-linked one.
+	Owners [DataSectors][]int
+	// Files holds a MapFile for every used directory slot, in slot
+	// order.
+	Files []*MapFile
+	// FreeSectors is the number of data sectors no file owns.
+	FreeSectors int
+	// FreeBytes is the number of file bytes the free sectors can
+	// hold: 510 per sector, since the last 2 bytes of each sector
+	// link to the next one.
+	FreeBytes int
+	// FreeSlots is the number of directory slots available for new
+	// files.
+	FreeSlots int
+	// CrossLinked is the number of data sectors owned by more than
+	// one file.
+	CrossLinked int
+}
+
+// MapFile is the allocation summary of one file of a DiskMap.
+type MapFile struct {
+	Slot    int
+	Name    string
+	Sectors int
+	// Fragments is the number of runs of consecutive sectors that
+	// the file's sector chain is made of: 1 for an unfragmented
+	// file.
+	Fragments int
+}
+
+// DataSector returns the data sector with SectorAddressMap bit index
+// index (0–1559), the inverse of Sector.SAMMask.
+func DataSector(index int) *Sector {
+	track := index/10 + 4
+	if track >= 80 {
+		track += 48
+	}
+	return &Sector{
+		Track:  uint8(track),
+		Sector: uint8(index%10 + 1),
+	}
+}
+
+// mapIndex returns the SectorAddressMap bit index of data sector
+// sector.
+func (sector *Sector) mapIndex() int {
+	return (int(sector.Track)&0x7f)*10 + int(sector.Sector) - 1 + ((int(sector.Track)&0x80)>>7)*800 - 40
+}
+
+// Map returns the allocation map of di's data sectors. Ownership comes
+// from the entries' sector address maps, as with
+// DiskJournal.CombinedSectorMap; fragment counts come from following
+// each file's sector chain, as far as it is valid.
+func (di *DiskImage) Map() *DiskMap {
+	m := &DiskMap{}
+	dj := di.DiskJournal()
+	for _, slot := range dj.UsedFileEntries() {
+		fe := dj[slot]
+		for _, sector := range fe.SectorAddressMap.UsedSectors() {
+			index := sector.mapIndex()
+			m.Owners[index] = append(m.Owners[index], slot)
+		}
+		chain, _, _ := di.sectorChain(fe.FirstSector)
+		fragments := 0
+		for i, sector := range chain {
+			if i == 0 || sector.mapIndex() != chain[i-1].mapIndex()+1 {
+				fragments++
+			}
+		}
+		m.Files = append(m.Files, &MapFile{
+			Slot:      slot,
+			Name:      fe.Name.String(),
+			Sectors:   int(fe.Sectors),
+			Fragments: fragments,
+		})
+	}
+	for _, owners := range m.Owners {
+		switch {
+		case len(owners) == 0:
+			m.FreeSectors++
+		case len(owners) > 1:
+			m.CrossLinked++
+		}
+	}
+	m.FreeBytes = m.FreeSectors * 510
+	m.FreeSlots = len(dj.FreeFileEntries())
+	return m
+}
+
+// owner returns the owners of sector (any sector of the disk), and
+// whether it is a directory sector.
+func (m *DiskMap) owner(track, sector int) (owners []int, directory bool) {
+	if track < 4 {
+		return nil, true
+	}
+	s := &Sector{Track: uint8(track), Sector: uint8(sector)}
+	return m.Owners[s.mapIndex()], false
+}
+
+// WriteText writes m to w as a grid, one row per track with side 0's
+// track alongside side 1's, and one column per sector. Each sector
+// shows the slot (00–79) that owns it, ".." if free, "XX" if
+// cross-linked or "DD" if part of the directory. A summary of free
+// space and of each file's fragments follows.
+func (m *DiskMap) WriteText(w io.Writer) error {
+	header := "Track  " + sectorHeadings() + "   Track  " + sectorHeadings()
+	if _, err := fmt.Fprintln(w, header); err != nil {
+		return err
+	}
+	for track := 0; track < 80; track++ {
+		line := fmt.Sprintf("%5v  %v   %5v  %v", track, m.trackCells(track), track+128, m.trackCells(track+128))
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	summary := fmt.Sprintf("\nFree: %v sectors (%v bytes), %v slots\nCross-linked: %v sectors\n", m.FreeSectors, m.FreeBytes, m.FreeSlots, m.CrossLinked)
+	if _, err := fmt.Fprint(w, summary); err != nil {
+		return err
+	}
+	for _, f := range m.Files {
+		if _, err := fmt.Fprintf(w, "%02d %-10v %4v sectors, %v fragments\n", f.Slot, f.Name, f.Sectors, f.Fragments); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sectorHeadings returns the column headings of a track of
+// DiskMap.WriteText.
+func sectorHeadings() string {
+	headings := []string{}
+	for sector := 1; sector <= 10; sector++ {
+		headings = append(headings, fmt.Sprintf("%2v", sector))
+	}
+	return strings.Join(headings, " ")
+}
+
+// trackCells returns the cells of track of DiskMap.WriteText.
+func (m *DiskMap) trackCells(track int) string {
+	cells := []string{}
+	for sector := 1; sector <= 10; sector++ {
+		owners, directory := m.owner(track, sector)
+		switch {
+		case directory:
+			cells = append(cells, "DD")
+		case len(owners) == 0:
+			cells = append(cells, "..")
+		case len(owners) > 1:
+			cells = append(cells, "XX")
+		default:
+			cells = append(cells, fmt.Sprintf("%02d", owners[0]))
+		}
+	}
+	return strings.Join(cells, " ")
+}
+
+// colour returns the colour of a sector of DiskMap.Image and
+// DiskMap.WriteSVG: white if free, grey if part of the directory, red
+// if cross-linked, and otherwise a colour that tells neighbouring
+// slots apart.
+func (m *DiskMap) colour(track, sector int) color.RGBA {
+	owners, directory := m.owner(track, sector)
+	switch {
+	case directory:
+		return mapDirectoryColour
+	case len(owners) == 0:
+		return mapFreeColour
+	case len(owners) > 1:
+		return mapCrossLinkedColour
+	}
+	return mapSlotColours[owners[0]%len(mapSlotColours)]
+}
+
+// Image renders m as an image with one column per track and one row
+// per sector, side 0 above side 1, colouring each sector as
+// DiskMap.WriteSVG does.
+func (m *DiskMap) Image() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 80*mapCellSize+1, 21*mapCellSize+1))
+	for y := 0; y < img.Rect.Dy(); y++ {
+		for x := 0; x < img.Rect.Dx(); x++ {
+			img.SetRGBA(x, y, mapBorderColour)
+		}
+	}
+	m.cells(func(x, y int, c color.RGBA) {
+		for py := 1; py < mapCellSize; py++ {
+			for px := 1; px < mapCellSize; px++ {
+				img.SetRGBA(x*mapCellSize+px, y*mapCellSize+py, c)
+			}
+		}
+	})
+	return img
+}
+
+// WriteSVG writes m to w as an SVG image laid out as DiskMap.Image,
+// with each sector titled with its location and owner.
+func (m *DiskMap) WriteSVG(w io.Writer) error {
+	width, height := 80*mapCellSize+1, 21*mapCellSize+1
+	var err error
+	printf := func(format string, a ...any) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, a...)
+		}
+	}
+	printf("<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%v\" height=\"%v\">\n", width, height)
+	printf("<rect width=\"%v\" height=\"%v\" fill=\"#%02x%02x%02x\"/>\n", width, height, mapBorderColour.R, mapBorderColour.G, mapBorderColour.B)
+	m.cells(func(x, y int, c color.RGBA) {
+		track, sector := x+128*(y/11), y%11+1
+		title := "free"
+		owners, directory := m.owner(track, sector)
+		switch {
+		case directory:
+			title = "directory"
+		case len(owners) > 0:
+			names := []string{}
+			for _, slot := range owners {
+				names = append(names, fmt.Sprintf("slot %v", slot))
+			}
+			title = strings.Join(names, ", ")
+		}
+		printf("<rect x=\"%v\" y=\"%v\" width=\"%v\" height=\"%v\" fill=\"#%02x%02x%02x\"><title>Track %v / Sector %v: %v</title></rect>\n", x*mapCellSize+1, y*mapCellSize+1, mapCellSize-1, mapCellSize-1, c.R, c.G, c.B, track, sector, title)
+	})
+	printf("</svg>\n")
+	return err
+}
+
+// cells calls draw with the grid position and colour of every sector
+// of the disk: x is the track (0–79) and y the sector (0–9) of side 0,
+// or 11–20 for side 1, leaving a blank row between the sides.
+func (m *DiskMap) cells(draw func(x, y int, c color.RGBA)) {
+	for side := 0; side < 2; side++ {
+		for track := 0; track < 80; track++ {
+			for sector := 1; sector <= 10; sector++ {
+				draw(track, side*11+sector-1, m.colour(track+side*128, sector))
+			}
+		}
+	}
+}
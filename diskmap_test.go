@@ -0,0 +1,86 @@
+package samfile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDataSector(t *testing.T) {
+	for index := 0; index < DataSectors; index++ {
+		sector := DataSector(index)
+		if err := checkDataSector(sector); err != nil {
+			t.Fatalf("sector %v: %v", index, err)
+		}
+		offset, mask := sector.SAMMask()
+		if int(offset)*8+bitPosition(mask) != index {
+			t.Fatalf("%v has map index %v, not %v", sector, int(offset)*8+bitPosition(mask), index)
+		}
+	}
+}
+
+func bitPosition(mask uint8) int {
+	position := 0
+	for mask > 1 {
+		mask >>= 1
+		position++
+	}
+	return position
+}
+
+func TestMap(t *testing.T) {
+	m := testImage(t).Map()
+	if m.FreeSectors != 217 || m.FreeBytes != 217*510 || m.FreeSlots != 45 || m.CrossLinked != 0 {
+		t.Errorf("unexpected summary: %v free sectors, %v free bytes, %v free slots, %v cross-linked", m.FreeSectors, m.FreeBytes, m.FreeSlots, m.CrossLinked)
+	}
+	if len(m.Files) != 35 || m.Files[3].Name != "ETRACKER" || m.Files[3].Fragments != 2 || m.Files[4].Fragments != 1 {
+		t.Errorf("unexpected files %+v, %+v", m.Files[3], m.Files[4])
+	}
+	if owners := m.Owners[(&Sector{Track: 4, Sector: 1}).mapIndex()]; len(owners) != 1 || owners[0] != 0 {
+		t.Errorf("expected slot 0 to own track 4 sector 1, got %v", owners)
+	}
+
+	var text bytes.Buffer
+	if err := m.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(text.String(), "\n")
+	if want := "    0  DD DD DD DD DD DD DD DD DD DD     128  16 16 16 16 16 16 16 16 16 16"; lines[1] != want {
+		t.Errorf("expected first track row %q but got %q", want, lines[1])
+	}
+	if bounds := m.Image().Bounds(); bounds.Dx() != 641 || bounds.Dy() != 169 {
+		t.Errorf("unexpected image size %v", bounds)
+	}
+	var svg bytes.Buffer
+	if err := m.WriteSVG(&svg); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(svg.String(), "<title>"); n != 1600 {
+		t.Errorf("expected 1600 sectors in SVG but got %v", n)
+	}
+}
+
+func TestMapCrossLinked(t *testing.T) {
+	di := NewDiskImage()
+	for _, name := range []string{"ONE", "TWO"} {
+		if err := di.AddCodeFile(name, bytes.Repeat([]byte{7}, 2000), 0x8000, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dj := di.DiskJournal()
+	first := dj[0].FirstSector
+	offset, mask := first.SAMMask()
+	dj[1].SectorAddressMap[offset] |= mask
+	di.WriteFileEntry(dj, 1)
+
+	m := di.Map()
+	if m.CrossLinked != 1 || m.FreeSectors != DataSectors-8 || m.FreeSlots != 78 {
+		t.Errorf("unexpected summary: %v cross-linked, %v free sectors, %v free slots", m.CrossLinked, m.FreeSectors, m.FreeSlots)
+	}
+	if owners := m.Owners[first.mapIndex()]; len(owners) != 2 {
+		t.Errorf("expected 2 owners of %v but got %v", first, owners)
+	}
+	if m.Files[0].Fragments != 1 || m.Files[1].Fragments != 1 {
+		t.Errorf("unexpected fragments %v, %v", m.Files[0].Fragments, m.Files[1].Fragments)
+	}
+}
@@ -0,0 +1,160 @@
+package samfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// EDSK ("Extended CPC DSK") image layout, per
+// https://www.cpcwiki.eu/index.php/Format:DSK_disk_image_file_format:
+//
+// A 256-byte Disk Information Block holds the magic, a 14-byte creator
+// name at 0x22, the track count at 0x30, the side count at 0x31 and,
+// from 0x34, one byte per track (cylinder-interleaved: track 0 side 0,
+// track 0 side 1, track 1 side 0, ...) giving that track's stored size
+// in units of 256 bytes (0 for an unformatted track).
+//
+// Each stored track is a 256-byte Track Information Block followed by
+// its sector data. The block holds "Track-Info\r\n", the track and side
+// numbers at 0x10–0x11, the sector size code at 0x14, the sector count
+// at 0x15, GAP#3 at 0x16, the filler byte at 0x17 and, from 0x18, an
+// 8-byte entry per sector: C, H, R (sector ID), N (size code), FDC
+// status registers 1 and 2, and the stored data length (little
+// endian). Sector data follows in the order of the entries.
+const (
+	edskInfoSize        = 0x100
+	edskTrackHeaderSize = 0x100
+	edskTrackSize       = edskTrackHeaderSize + 10*512
+	edskSizeCode512     = 2
+	edskGap3            = 0x18 // nominal SAMDOS-format GAP#3
+	edskFiller          = 0xe5
+)
+
+var edskTrackMagic = []byte("Track-Info\r\n")
+
+// DiskImageFromEDSK converts the contents of an Extended CPC DSK image
+// file to a DiskImage. Every formatted track must be a SAM-format
+// track: on side 0 or 1, within the first 80 cylinders, with ten
+// 512-byte sectors numbered 1–10. Tracks absent from the EDSK image
+// (or unformatted) are left zero-filled. Returns an error describing
+// the first track or sector that doesn't fit the MGT geometry.
+func DiskImageFromEDSK(data []byte) (*DiskImage, error) {
+	if len(data) < edskInfoSize || !bytes.HasPrefix(data, edskMagic) {
+		return nil, fmt.Errorf("not an EDSK image: missing %q header", edskMagic)
+	}
+	tracks := int(data[0x30])
+	sides := int(data[0x31])
+	if sides < 1 || sides > 2 {
+		return nil, fmt.Errorf("EDSK image has %v sides; SAM disks have 1 or 2", sides)
+	}
+	if tracks > 80 {
+		return nil, fmt.Errorf("EDSK image has %v tracks; SAM disks have at most 80", tracks)
+	}
+	if tracks*sides > edskInfoSize-0x34 {
+		return nil, fmt.Errorf("EDSK image has too many tracks (%v × %v sides)", tracks, sides)
+	}
+	d := DiskImage{}
+	offset := edskInfoSize
+	for i := 0; i < tracks*sides; i++ {
+		size := int(data[0x34+i]) << 8
+		if size == 0 {
+			continue
+		}
+		if offset+size > len(data) {
+			return nil, fmt.Errorf("EDSK image truncated: track block %v needs %v bytes at offset %v but file is only %v bytes", i, size, offset, len(data))
+		}
+		if err := d.readEDSKTrack(data[offset : offset+size]); err != nil {
+			return nil, err
+		}
+		offset += size
+	}
+	return &d, nil
+}
+
+// readEDSKTrack copies the sectors of one EDSK track block into di.
+func (di *DiskImage) readEDSKTrack(block []byte) error {
+	if len(block) < edskTrackHeaderSize || !bytes.HasPrefix(block, edskTrackMagic) {
+		return fmt.Errorf("EDSK track block missing %q header", edskTrackMagic)
+	}
+	cylinder := block[0x10]
+	side := block[0x11]
+	count := int(block[0x15])
+	if cylinder >= 80 || side > 1 {
+		return fmt.Errorf("EDSK track %v side %v is outside the SAM disk geometry (80 tracks, 2 sides)", cylinder, side)
+	}
+	if count == 0 {
+		return nil
+	}
+	if count != 10 {
+		return fmt.Errorf("EDSK track %v side %v has %v sectors; SAM-format tracks have 10", cylinder, side, count)
+	}
+	seen := [11]bool{}
+	offset := edskTrackHeaderSize
+	for i := 0; i < count; i++ {
+		info := block[0x18+8*i : 0x18+8*(i+1)]
+		id := info[2]
+		length := int(binary.LittleEndian.Uint16(info[6:]))
+		if length == 0 {
+			length = 128 << (info[3] & 0x07)
+		}
+		if info[3] != edskSizeCode512 || length != 512 {
+			return fmt.Errorf("EDSK track %v side %v sector %v is %v bytes (size code %v); only 512-byte SAM-format sectors are supported", cylinder, side, id, length, info[3])
+		}
+		if id < 1 || id > 10 || seen[id] {
+			return fmt.Errorf("EDSK track %v side %v has unexpected sector ID %v; SAM-format tracks have sectors 1-10", cylinder, side, id)
+		}
+		seen[id] = true
+		if offset+length > len(block) {
+			return fmt.Errorf("EDSK track %v side %v truncated at sector %v", cylinder, side, id)
+		}
+		sector := &Sector{
+			Track:  cylinder | side<<7,
+			Sector: id,
+		}
+		sd := &SectorData{}
+		copy(sd[:], block[offset:offset+length])
+		di.WriteSector(sector, sd)
+		offset += length
+	}
+	return nil
+}
+
+// EDSK encodes di as an Extended CPC DSK image file: 80 tracks × 2
+// sides, each with ten 512-byte sectors numbered 1–10 in ascending
+// order. Inverse of DiskImageFromEDSK.
+func (di *DiskImage) EDSK() []byte {
+	out := make([]byte, edskInfoSize, edskInfoSize+160*edskTrackSize)
+	copy(out, edskMagic)
+	copy(out[len(edskMagic):], "\r\nDisk-Info\r\n")
+	copy(out[0x22:0x30], "samfile")
+	out[0x30] = 80
+	out[0x31] = 2
+	for i := 0; i < 160; i++ {
+		out[0x34+i] = edskTrackSize >> 8
+	}
+	for cylinder := uint8(0); cylinder < 80; cylinder++ {
+		for side := uint8(0); side < 2; side++ {
+			header := make([]byte, edskTrackHeaderSize)
+			copy(header, edskTrackMagic)
+			header[0x10] = cylinder
+			header[0x11] = side
+			header[0x14] = edskSizeCode512
+			header[0x15] = 10
+			header[0x16] = edskGap3
+			header[0x17] = edskFiller
+			for s := 0; s < 10; s++ {
+				info := header[0x18+8*s:]
+				info[0] = cylinder
+				info[1] = side
+				info[2] = uint8(s + 1)
+				info[3] = edskSizeCode512
+				binary.LittleEndian.PutUint16(info[6:], 512)
+			}
+			out = append(out, header...)
+			offset := (&Sector{Track: cylinder | side<<7, Sector: 1}).Offset()
+			out = append(out, di[offset:offset+10*512]...)
+		}
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package samfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEDSKRoundTrip(t *testing.T) {
+	di, err := Load(filepath.Join("testdata", "ETrackerv1.2.mgt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	edsk := di.EDSK()
+	if len(edsk) != 256+160*(256+10*512) {
+		t.Fatalf("unexpected EDSK size %v", len(edsk))
+	}
+	converted, err := DiskImageFromEDSK(edsk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *converted != *di {
+		t.Fatalf("MGT -> EDSK -> MGT round trip changed the image")
+	}
+
+	filename := filepath.Join(t.TempDir(), "image.dsk")
+	if err := os.WriteFile(filename, edsk, 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, container, err := LoadContainer(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if container.Format != FORMAT_EDSK || *loaded != *di {
+		t.Fatalf("LoadContainer returned format %v and a different image", container.Format)
+	}
+	if err := loaded.SaveContainer(filename, container); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != string(edsk) {
+		t.Errorf("SaveContainer did not write the image back as EDSK")
+	}
+}
+
+func TestEDSKRejectsNonSAMGeometry(t *testing.T) {
+	edsk := NewDiskImage().EDSK()
+	// Change the size code of the first sector of the first track to
+	// 1 (256 bytes).
+	edsk[0x100+0x18+3] = 1
+	_, err := DiskImageFromEDSK(edsk)
+	if err == nil || !strings.Contains(err.Error(), "512-byte") {
+		t.Fatalf("expected 512-byte sector error, got %v", err)
+	}
+	edsk = NewDiskImage().EDSK()
+	edsk[0x100+0x15] = 9
+	if _, err := DiskImageFromEDSK(edsk); err == nil {
+		t.Fatalf("expected error for a 9-sector track")
+	}
+}
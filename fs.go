@@ -0,0 +1,229 @@
+package samfile
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// FS is a read-only io/fs view of the files on a DiskImage,
+	// returned by DiskImage.FS. It implements fs.FS, fs.ReadDirFS and
+	// fs.StatFS. The disk's files all sit in the root directory ".";
+	// each is named after its trimmed Filename.String(), with any '/'
+	// replaced by '#' (the same substitution `samfile extract` makes).
+	//
+	// The fs.FileInfo of each file reports Length as its Size, and
+	// its Sys method returns the file's *FileEntry. The directory is
+	// read when FS is created, so later changes to the image are not
+	// reflected.
+	FS struct {
+		di      *DiskImage
+		entries []*fsEntry
+	}
+
+	// fsEntry is one directory entry of an FS; it implements both
+	// fs.FileInfo and fs.DirEntry.
+	fsEntry struct {
+		name string
+		fe   *FileEntry // nil for the root directory
+	}
+
+	// fsFile is an open regular file of an FS.
+	fsFile struct {
+		*bytes.Reader
+		entry *fsEntry
+	}
+
+	// fsDir is the open root directory of an FS.
+	fsDir struct {
+		fsys   *FS
+		offset int
+	}
+)
+
+// FS returns an io/fs view of the files on the disk image. Files are
+// listed in directory slot order; an occupied slot is omitted if its
+// name is empty, is "." or "..", or duplicates the name of an earlier
+// slot, since fs.FS paths must be valid and unique.
+func (di *DiskImage) FS() *FS {
+	fsys := &FS{di: di}
+	seen := map[string]bool{}
+	dj := di.DiskJournal()
+	for _, slot := range dj.UsedFileEntries() {
+		name := strings.ReplaceAll(dj[slot].Name.String(), "/", "#")
+		if name == "" || name == "." || name == ".." || seen[name] {
+			continue
+		}
+		seen[name] = true
+		fsys.entries = append(fsys.entries, &fsEntry{name: name, fe: dj[slot]})
+	}
+	return fsys
+}
+
+// lookup returns the entry called name, or the root directory for
+// ".".
+func (fsys *FS) lookup(op, name string) (*fsEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &fsEntry{name: "."}, nil
+	}
+	for _, entry := range fsys.entries {
+		if entry.name == name {
+			return entry, nil
+		}
+	}
+	return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// Open opens the named file for reading, or "." for the root
+// directory. Implements fs.FS.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	entry, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if entry.fe == nil {
+		return &fsDir{fsys: fsys}, nil
+	}
+	f, err := fsys.di.ReadFile(entry.fe)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &fsFile{Reader: bytes.NewReader(f.Body), entry: entry}, nil
+}
+
+// Stat returns the fs.FileInfo of the named file, or of "." for the
+// root directory. Implements fs.StatFS.
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	entry, err := fsys.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// ReadDir returns the files in the root directory, sorted by name.
+// name must be "." as the disk has no subdirectories. Implements
+// fs.ReadDirFS.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if entry.fe != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	dirEntries := make([]fs.DirEntry, len(fsys.entries))
+	for i, entry := range fsys.entries {
+		dirEntries[i] = entry
+	}
+	sort.Slice(dirEntries, func(i, j int) bool {
+		return dirEntries[i].Name() < dirEntries[j].Name()
+	})
+	return dirEntries, nil
+}
+
+// Name returns the base name of the file.
+func (entry *fsEntry) Name() string {
+	return entry.name
+}
+
+// Size returns the length of the file body (FileEntry.Length, or
+// SnapshotLength for an FT_ZX_SNAPSHOT file).
+func (entry *fsEntry) Size() int64 {
+	switch {
+	case entry.fe == nil:
+		return 0
+	case entry.fe.Type == FT_ZX_SNAPSHOT:
+		return SnapshotLength
+	}
+	return int64(entry.fe.Length())
+}
+
+// Mode returns read-only permissions: 0444 for files, 0555 for the
+// root directory.
+func (entry *fsEntry) Mode() fs.FileMode {
+	if entry.fe == nil {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// ModTime returns the zero time: SAMDOS does not record timestamps.
+func (entry *fsEntry) ModTime() time.Time {
+	return time.Time{}
+}
+
+// IsDir reports whether entry is the root directory.
+func (entry *fsEntry) IsDir() bool {
+	return entry.fe == nil
+}
+
+// Sys returns the file's *FileEntry (nil for the root directory).
+func (entry *fsEntry) Sys() any {
+	if entry.fe == nil {
+		return nil
+	}
+	return entry.fe
+}
+
+// Type returns the type bits of Mode. Implements fs.DirEntry.
+func (entry *fsEntry) Type() fs.FileMode {
+	return entry.Mode().Type()
+}
+
+// Info returns entry itself. Implements fs.DirEntry.
+func (entry *fsEntry) Info() (fs.FileInfo, error) {
+	return entry, nil
+}
+
+// Stat returns the file's fs.FileInfo.
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return f.entry, nil
+}
+
+// Close is a no-op; the file body is held in memory.
+func (f *fsFile) Close() error {
+	return nil
+}
+
+// Stat returns the root directory's fs.FileInfo.
+func (d *fsDir) Stat() (fs.FileInfo, error) {
+	return &fsEntry{name: "."}, nil
+}
+
+// Read returns an error: the root directory is not a regular file.
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ".", Err: fs.ErrInvalid}
+}
+
+// Close is a no-op.
+func (d *fsDir) Close() error {
+	return nil
+}
+
+// ReadDir returns up to n of the remaining files in slot order, or all
+// of them if n <= 0. Implements fs.ReadDirFile.
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.fsys.entries[d.offset:]
+	if n > 0 {
+		if len(remaining) == 0 {
+			return nil, io.EOF
+		}
+		if n < len(remaining) {
+			remaining = remaining[:n]
+		}
+	}
+	dirEntries := make([]fs.DirEntry, len(remaining))
+	for i, entry := range remaining {
+		dirEntries[i] = entry
+	}
+	d.offset += len(remaining)
+	return dirEntries, nil
+}
@@ -0,0 +1,56 @@
+package samfile
+
+import (
+	"bytes"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	di := NewDiskImage()
+	files := map[string][]byte{
+		"LOADER":     []byte("loader"),
+		"SCREEN/1":   bytes.Repeat([]byte{1}, 6912),
+		"GAME.BIN":   bytes.Repeat([]byte{2, 3}, 20000),
+		"EMPTY FILE": {},
+	}
+	for _, name := range []string{"LOADER", "SCREEN/1", "GAME.BIN", "EMPTY FILE"} {
+		if err := di.AddCodeFile(name, files[name], 0x8000, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := di.AddCodeFile("LOADER", []byte("duplicate"), 0x8000, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := di.DeleteFile("EMPTY FILE", false); err != nil {
+		t.Fatal(err)
+	}
+	fsys := di.FS()
+	if err := fstest.TestFS(fsys, "LOADER", "SCREEN#1", "GAME.BIN"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := fs.ReadFile(fsys, "GAME.BIN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, files["GAME.BIN"]) {
+		t.Errorf("fs.ReadFile returned wrong contents")
+	}
+	info, err := fs.Stat(fsys, "SCREEN#1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fe, ok := info.Sys().(*FileEntry)
+	if !ok || fe.Name.String() != "SCREEN/1" || info.Size() != 6912 {
+		t.Errorf("unexpected FileInfo: Sys() = %v, Size() = %v", info.Sys(), info.Size())
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("expected 3 files (duplicate and erased files omitted), got %v", len(entries))
+	}
+}
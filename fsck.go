@@ -0,0 +1,368 @@
+package samfile
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type (
+	// ProblemKind classifies a Problem reported by DiskImage.Check.
+	// The values are short, stable, kebab-case identifiers suitable for
+	// machine consumption; see the PK_* constants.
+	ProblemKind string
+
+	// Problem is one inconsistency found by DiskImage.Check in a used
+	// directory entry. Slot is the directory slot (0–79) of the file
+	// concerned and Name its trimmed filename; Description is a human
+	// readable explanation of what is wrong.
+	Problem struct {
+		Slot        int         `json:"slot"`
+		Name        string      `json:"name"`
+		Kind        ProblemKind `json:"kind"`
+		Description string      `json:"description"`
+	}
+)
+
+// Kinds of Problem reported by DiskImage.Check.
+const (
+	// The sector chain links to (or starts at) a sector outside the
+	// data area: an invalid track or sector number, or one of the
+	// directory tracks 0–3.
+	PK_BAD_CHAIN_SECTOR = ProblemKind("bad-chain-sector")
+	// The sector chain links back to a sector it has already visited.
+	PK_CHAIN_LOOP = ProblemKind("chain-loop")
+	// The sectors visited by the chain differ from the sectors set in
+	// the entry's SectorAddressMap.
+	PK_CHAIN_MAP_MISMATCH = ProblemKind("chain-map-mismatch")
+	// The entry's Sectors count disagrees with the length of the chain
+	// or with the number of sectors required to hold Length bytes.
+	PK_SECTOR_COUNT = ProblemKind("sector-count")
+	// A sector is claimed by the SectorAddressMap of more than one file.
+	PK_CROSS_LINKED = ProblemKind("cross-linked")
+	// A directory field that mirrors the body's 9-byte FileHeader
+	// (Type, StartAddressPage, StartAddressPageOffset, Pages,
+	// LengthMod16K) disagrees with the header in the first sector.
+	PK_HEADER_MISMATCH = ProblemKind("header-mismatch")
+	// The copy of the body FileHeader cached in MGTFutureAndPast[1:10]
+	// disagrees with the header in the first sector. Not checked for
+	// slot 0 of a labelled disk, where those bytes hold the label, or
+	// when the copy is all spaces or all zeros, i.e. was never filled
+	// in.
+	PK_MIRROR_MISMATCH = ProblemKind("mirror-mismatch")
+)
+
+// String returns "slot N "NAME": kind: description".
+func (p *Problem) String() string {
+	return fmt.Sprintf("slot %v %q: %v: %v", p.Slot, p.Name, p.Kind, p.Description)
+}
+
+// checkDataSector returns an error if sector is not one of the 1560
+// data sectors (tracks 4–79 and 128–207, sectors 1–10).
+func checkDataSector(sector *Sector) error {
+	if sector.Sector < 1 || sector.Sector > 10 {
+		return fmt.Errorf("sector out of range: %v", sector)
+	}
+	if sector.Track < 4 {
+		return fmt.Errorf("sector in directory area: %v", sector)
+	}
+	if (sector.Track >= 80 && sector.Track < 128) || sector.Track >= 208 {
+		return fmt.Errorf("track out of range: %v", sector)
+	}
+	return nil
+}
+
+// sectorChain follows the sector chain that starts at first, until a
+// link with Track == 0 marks its end. It returns every valid data
+// sector visited, in chain order. If the chain starts at or links to a
+// sector outside the data area, or loops back on itself, the chain
+// gathered so far is returned together with the kind of problem and a
+// description of it; otherwise kind is "".
+func (di *DiskImage) sectorChain(first *Sector) (chain []*Sector, kind ProblemKind, description string) {
+	chain = []*Sector{}
+	visited := map[Sector]bool{}
+	sector := first
+	for {
+		if err := checkDataSector(sector); err != nil {
+			if len(chain) == 0 {
+				return chain, PK_BAD_CHAIN_SECTOR, fmt.Sprintf("first sector is invalid: %v", err)
+			}
+			return chain, PK_BAD_CHAIN_SECTOR, fmt.Sprintf("%v links to invalid sector: %v", chain[len(chain)-1], err)
+		}
+		if visited[*sector] {
+			return chain, PK_CHAIN_LOOP, fmt.Sprintf("%v links back to %v", chain[len(chain)-1], sector)
+		}
+		visited[*sector] = true
+		chain = append(chain, sector)
+		sectorData, _ := di.SectorData(sector)
+		next := sectorData.FilePart().NextSector
+		if next.Track == 0 {
+			return chain, "", ""
+		}
+		sector = next
+	}
+}
+
+// sectorsNotIn returns the members of sectors that are not in set.
+func sectorsNotIn(sectors []*Sector, set map[Sector]bool) []*Sector {
+	result := []*Sector{}
+	for _, sector := range sectors {
+		if !set[*sector] {
+			result = append(result, sector)
+		}
+	}
+	return result
+}
+
+// describeSectors lists sectors for a Problem description, eliding
+// all but the first and last of long lists.
+func describeSectors(sectors []*Sector) string {
+	if len(sectors) > 3 {
+		return fmt.Sprintf("%v, ..., %v", sectors[0], sectors[len(sectors)-1])
+	}
+	names := []string{}
+	for _, sector := range sectors {
+		names = append(names, sector.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// sectorsRequired returns the number of sectors needed to hold a file
+// body of length bytes plus its 9-byte header.
+func sectorsRequired(length uint32) uint32 {
+	return (length + 9 + 509) / 510
+}
+
+// Check walks every used directory entry and reports the
+// inconsistencies it finds between the directory and the data area:
+//
+//   - sector chains that start at or link to invalid sectors, or loop
+//     (PK_BAD_CHAIN_SECTOR, PK_CHAIN_LOOP)
+//   - chains that visit different sectors than the entry's
+//     SectorAddressMap records (PK_CHAIN_MAP_MISMATCH)
+//   - Sectors counts that disagree with the chain length or with
+//     Length (PK_SECTOR_COUNT)
+//   - sectors claimed by the maps of two or more files
+//     (PK_CROSS_LINKED)
+//   - directory fields that disagree with the body FileHeader
+//     (PK_HEADER_MISMATCH), and MGTFutureAndPast copies of the header
+//     that have drifted from it (PK_MIRROR_MISMATCH); ZX snapshots,
+//     whose bodies have no FileHeader, are exempt (see Snapshot)
+//
+// Problems are returned in slot order. An empty result means the
+// directory is coherent. Check does not modify the image.
+func (di *DiskImage) Check() []*Problem {
+	problems := []*Problem{}
+	dj := di.DiskJournal()
+	owners := map[Sector][]int{}
+	for _, slot := range dj.UsedFileEntries() {
+		fe := dj[slot]
+		name := fe.Name.String()
+		report := func(kind ProblemKind, format string, a ...any) {
+			problems = append(problems, &Problem{
+				Slot:        slot,
+				Name:        name,
+				Kind:        kind,
+				Description: fmt.Sprintf(format, a...),
+			})
+		}
+
+		mapped := fe.SectorAddressMap.UsedSectors()
+		for _, sector := range mapped {
+			owners[*sector] = append(owners[*sector], slot)
+		}
+
+		chain, kind, description := di.sectorChain(fe.FirstSector)
+		if kind != "" {
+			report(kind, "%v", description)
+		}
+
+		inChain := map[Sector]bool{}
+		for _, sector := range chain {
+			inChain[*sector] = true
+		}
+		inMap := map[Sector]bool{}
+		for _, sector := range mapped {
+			inMap[*sector] = true
+		}
+		if missing := sectorsNotIn(chain, inMap); len(missing) > 0 {
+			report(PK_CHAIN_MAP_MISMATCH, "%v sector(s) in the sector chain are not in the sector address map: %v", len(missing), describeSectors(missing))
+		}
+		if missing := sectorsNotIn(mapped, inChain); len(missing) > 0 {
+			report(PK_CHAIN_MAP_MISMATCH, "%v sector(s) in the sector address map are not in the sector chain: %v", len(missing), describeSectors(missing))
+		}
+
+		if kind == "" && int(fe.Sectors) != len(chain) {
+			report(PK_SECTOR_COUNT, "directory records %v sectors but the sector chain has %v", fe.Sectors, len(chain))
+		}
+		// A ZX snapshot's directory entry holds registers in place
+		// of the header mirror, and its body has no header (see
+		// Snapshot).
+		if fe.Type == FT_ZX_SNAPSHOT {
+			if required := uint16((SnapshotLength + 509) / 510); fe.Sectors != required {
+				report(PK_SECTOR_COUNT, "directory records %v sectors but a ZX snapshot requires %v", fe.Sectors, required)
+			}
+			continue
+		}
+		if required := sectorsRequired(fe.Length()); uint32(fe.Sectors) != required {
+			report(PK_SECTOR_COUNT, "directory records %v sectors but a %v byte file requires %v", fe.Sectors, fe.Length(), required)
+		}
+
+		if len(chain) == 0 {
+			continue
+		}
+		sectorData, _ := di.SectorData(chain[0])
+		var header [9]byte
+		copy(header[:], sectorData[:9])
+		for _, field := range []struct {
+			name        string
+			dir, body   uint32
+			hexadecimal bool
+		}{
+			{"Type", uint32(fe.Type), uint32(header[0]), false},
+			{"LengthMod16K", uint32(fe.LengthMod16K), uint32(header[1]) | uint32(header[2])<<8, true},
+			{"StartAddressPageOffset", uint32(fe.StartAddressPageOffset), uint32(header[3]) | uint32(header[4])<<8, true},
+			{"Pages", uint32(fe.Pages), uint32(header[7]), false},
+			{"StartAddressPage", uint32(fe.StartAddressPage), uint32(header[8]), true},
+		} {
+			if field.dir == field.body {
+				continue
+			}
+			if field.hexadecimal {
+				report(PK_HEADER_MISMATCH, "directory %v is 0x%04x but body header has 0x%04x", field.name, field.dir, field.body)
+			} else {
+				report(PK_HEADER_MISMATCH, "directory %v is %v but body header has %v", field.name, field.dir, field.body)
+			}
+		}
+		// On a labelled disk, slot 0's mirror bytes hold the label.
+		if slot == 0 && di.Label() != "" {
+			continue
+		}
+		// A mirror of all spaces or all zeros was never filled in
+		// (by older DOS versions, for example) rather than drifted.
+		mirror := *(*[9]byte)(fe.MGTFutureAndPast[1:10])
+		if mirror != header && mirror != [9]byte{} && !bytes.Equal(mirror[:], bytes.Repeat([]byte{' '}, 9)) {
+			report(PK_MIRROR_MISMATCH, "MGTFutureAndPast[1:10] is % x but body header is % x", fe.MGTFutureAndPast[1:10], header[:])
+		}
+	}
+
+	for _, slot := range dj.UsedFileEntries() {
+		for _, sector := range dj[slot].SectorAddressMap.UsedSectors() {
+			if len(owners[*sector]) < 2 {
+				continue
+			}
+			others := []string{}
+			for _, other := range owners[*sector] {
+				if other != slot {
+					others = append(others, fmt.Sprintf("slot %v %q", other, dj[other].Name.String()))
+				}
+			}
+			problems = append(problems, &Problem{
+				Slot:        slot,
+				Name:        dj[slot].Name.String(),
+				Kind:        PK_CROSS_LINKED,
+				Description: fmt.Sprintf("%v is also claimed by %v", sector, strings.Join(others, ", ")),
+			})
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Slot < problems[j].Slot
+	})
+	return problems
+}
+
+// Repair fixes the directory inconsistencies that can be corrected
+// mechanically, treating each file's sector chain and body FileHeader
+// as authoritative:
+//
+//   - chains that link to an invalid sector or loop back on themselves
+//     are truncated after the last good sector, by rewriting that
+//     sector's link to (0, 0)
+//   - each SectorAddressMap is rebuilt from the sectors of the chain
+//   - each Sectors count is set to the chain length
+//   - StartAddressPage, StartAddressPageOffset, Pages and LengthMod16K
+//     are re-synced from the body's 9-byte FileHeader, except for ZX
+//     snapshots, which have none
+//
+// Files whose first sector is itself invalid are left alone, as are
+// cross-linked sectors and MGTFutureAndPast drift, which need a human
+// decision; run Check afterwards to see what remains. The image is
+// modified in place but not saved. Repair returns one Problem per
+// change made, whose Kind is the kind of problem that was repaired
+// and whose Description says what was altered, so the changes can be
+// audited before calling Save.
+func (di *DiskImage) Repair() []*Problem {
+	changes := []*Problem{}
+	dj := di.DiskJournal()
+	for _, slot := range dj.UsedFileEntries() {
+		fe := dj[slot]
+		changed := false
+		report := func(kind ProblemKind, format string, a ...any) {
+			changes = append(changes, &Problem{
+				Slot:        slot,
+				Name:        fe.Name.String(),
+				Kind:        kind,
+				Description: fmt.Sprintf(format, a...),
+			})
+			changed = true
+		}
+
+		chain, kind, description := di.sectorChain(fe.FirstSector)
+		if len(chain) == 0 {
+			continue
+		}
+		if kind != "" {
+			last := chain[len(chain)-1]
+			offset := last.Offset()
+			di[offset+510] = 0
+			di[offset+511] = 0
+			report(kind, "%v; truncated chain to %v sector(s) by ending it at %v", description, len(chain), last)
+		}
+
+		sam := &SectorAddressMap{}
+		for _, sector := range chain {
+			offset, mask := sector.SAMMask()
+			sam[offset] |= mask
+		}
+		if *sam != *fe.SectorAddressMap {
+			fe.SectorAddressMap = sam
+			report(PK_CHAIN_MAP_MISMATCH, "rebuilt sector address map from the %v sector(s) of the sector chain", len(chain))
+		}
+		if int(fe.Sectors) != len(chain) {
+			report(PK_SECTOR_COUNT, "changed Sectors from %v to %v", fe.Sectors, len(chain))
+			fe.Sectors = uint16(len(chain))
+		}
+
+		if fe.Type == FT_ZX_SNAPSHOT {
+			if changed {
+				di.WriteFileEntry(dj, slot)
+			}
+			continue
+		}
+		sectorData, _ := di.SectorData(chain[0])
+		pageOffset := uint16(sectorData[3]) | uint16(sectorData[4])<<8
+		lengthMod16K := uint16(sectorData[1]) | uint16(sectorData[2])<<8
+		if fe.StartAddressPage != sectorData[8] {
+			report(PK_HEADER_MISMATCH, "changed StartAddressPage from 0x%02x to 0x%02x", fe.StartAddressPage, sectorData[8])
+			fe.StartAddressPage = sectorData[8]
+		}
+		if fe.StartAddressPageOffset != pageOffset {
+			report(PK_HEADER_MISMATCH, "changed StartAddressPageOffset from 0x%04x to 0x%04x", fe.StartAddressPageOffset, pageOffset)
+			fe.StartAddressPageOffset = pageOffset
+		}
+		if fe.Pages != sectorData[7] {
+			report(PK_HEADER_MISMATCH, "changed Pages from %v to %v", fe.Pages, sectorData[7])
+			fe.Pages = sectorData[7]
+		}
+		if fe.LengthMod16K != lengthMod16K {
+			report(PK_HEADER_MISMATCH, "changed LengthMod16K from 0x%04x to 0x%04x", fe.LengthMod16K, lengthMod16K)
+			fe.LengthMod16K = lengthMod16K
+		}
+
+		if changed {
+			di.WriteFileEntry(dj, slot)
+		}
+	}
+	return changes
+}
@@ -0,0 +1,123 @@
+package samfile
+
+import (
+	"bytes"
+	"testing"
+)
+
+func problemKinds(problems []*Problem) map[ProblemKind]int {
+	kinds := map[ProblemKind]int{}
+	for _, p := range problems {
+		kinds[p.Kind]++
+	}
+	return kinds
+}
+
+func TestCheckCleanImage(t *testing.T) {
+	di := NewDiskImage()
+	if err := di.AddCodeFile("CODE", bytes.Repeat([]byte{7}, 5000), 0x8000, 0x8000); err != nil {
+		t.Fatal(err)
+	}
+	if problems := di.Check(); len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v", problems)
+	}
+}
+
+func TestCheckDetectsProblems(t *testing.T) {
+	di := NewDiskImage()
+	for _, name := range []string{"ONE", "TWO"} {
+		if err := di.AddCodeFile(name, bytes.Repeat([]byte{7}, 2000), 0x8000, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dj := di.DiskJournal()
+
+	// Make ONE's last sector loop back to its first sector.
+	chain := dj[0].SectorAddressMap.UsedSectors()
+	last := chain[len(chain)-1].Offset()
+	di[last+510] = chain[0].Track
+	di[last+511] = chain[0].Sector
+
+	// Make TWO claim ONE's first sector too, and a wrong header length.
+	offset, mask := chain[0].SAMMask()
+	dj[1].SectorAddressMap[offset] |= mask
+	dj[1].Sectors++
+	di.WriteFileEntry(dj, 1)
+	di[dj[1].FirstSector.Offset()+1] ^= 0xff
+
+	kinds := problemKinds(di.Check())
+	for kind, want := range map[ProblemKind]int{
+		PK_CHAIN_LOOP:         1,
+		PK_CROSS_LINKED:       2,
+		PK_CHAIN_MAP_MISMATCH: 1,
+		PK_SECTOR_COUNT:       2,
+		PK_HEADER_MISMATCH:    1,
+		PK_MIRROR_MISMATCH:    1,
+	} {
+		if kinds[kind] != want {
+			t.Errorf("expected %v %v problem(s), got %v", want, kind, kinds[kind])
+		}
+	}
+}
+
+func TestRepair(t *testing.T) {
+	di := NewDiskImage()
+	if err := di.AddCodeFile("BROKEN", bytes.Repeat([]byte{7}, 2000), 0x8000, 0); err != nil {
+		t.Fatal(err)
+	}
+	dj := di.DiskJournal()
+	chain := dj[0].SectorAddressMap.UsedSectors()
+
+	// Point the second sector's link at the directory, and desync the
+	// directory's copy of the header.
+	second := chain[1].Offset()
+	di[second+510] = 1
+	di[second+511] = 1
+	dj[0].StartAddressPageOffset = 0x1234
+	di.WriteFileEntry(dj, 0)
+
+	changes := di.Repair()
+	kinds := problemKinds(changes)
+	for kind, want := range map[ProblemKind]int{
+		PK_BAD_CHAIN_SECTOR:   1,
+		PK_CHAIN_MAP_MISMATCH: 1,
+		PK_SECTOR_COUNT:       1,
+		PK_HEADER_MISMATCH:    1,
+	} {
+		if kinds[kind] != want {
+			t.Errorf("expected %v %v repair(s), got %v", want, kind, kinds[kind])
+		}
+	}
+	fe := di.DiskJournal()[0]
+	if fe.Sectors != 2 || len(fe.SectorAddressMap.UsedSectors()) != 2 {
+		t.Errorf("expected chain truncated to 2 sectors, got Sectors=%v, map=%v", fe.Sectors, fe.SectorAddressMap.UsedSectors())
+	}
+	if fe.StartAddressPageOffset != 0x8000 {
+		t.Errorf("expected StartAddressPageOffset re-synced to 0x8000, got 0x%04x", fe.StartAddressPageOffset)
+	}
+	if di[second+510] != 0 || di[second+511] != 0 {
+		t.Errorf("expected truncated chain to end with a (0, 0) link")
+	}
+	if changes := di.Repair(); len(changes) != 0 {
+		t.Errorf("expected second Repair to make no changes, got %v", changes)
+	}
+}
+
+func TestCheckETrackerFixture(t *testing.T) {
+	di, err := Load("testdata/ETrackerv1.2.mgt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// COMPILER and POPCORN .M have all-space MGTFutureAndPast mirrors,
+	// which were never filled in rather than drifted. Only AXEL F's
+	// broken chain is a genuine problem.
+	problems := di.Check()
+	for _, p := range problems {
+		if p.Slot != 17 {
+			t.Errorf("unexpected problem %v", p)
+		}
+	}
+	if kinds := problemKinds(problems); kinds[PK_BAD_CHAIN_SECTOR] != 1 || kinds[PK_MIRROR_MISMATCH] != 0 {
+		t.Errorf("expected only AXEL F's chain break, got %v", problems)
+	}
+}
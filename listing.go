@@ -0,0 +1,91 @@
+package samfile
+
+import (
+	"strings"
+)
+
+// ListEntry is one row of a directory listing: the fields of a used
+// directory entry that `samfile ls` prints, decoded. Fields that only
+// apply to some file types are nil (or empty) for the others.
+type ListEntry struct {
+	// Slot is the directory slot (0–79) of the file.
+	Slot int    `json:"slot"`
+	Name string `json:"name"`
+	// Type is the file type's name (see FileType.String).
+	Type string `json:"type"`
+	// Attributes lists the set attributes: "HIDDEN", "PROTECTED".
+	Attributes  []string `json:"attributes"`
+	Sectors     int      `json:"sectors"`
+	FirstTrack  int      `json:"first_track"`
+	FirstSector int      `json:"first_sector"`
+	// Start is the load address (see FileEntry.StartAddress), or 0
+	// for a ZX snapshot, which has none.
+	Start  uint32 `json:"start,omitempty"`
+	Length uint32 `json:"length"`
+	// ExecutionAddress is set for FT_CODE files that auto-execute.
+	ExecutionAddress *uint32 `json:"execution_address,omitempty"`
+	// StartLine is set for FT_SAM_BASIC files that auto-RUN.
+	StartLine *uint16 `json:"start_line,omitempty"`
+	// The sizes of the sections of an FT_SAM_BASIC file.
+	ProgramLength            *uint32 `json:"program_length,omitempty"`
+	NumericVariablesSize     *uint32 `json:"numeric_variables_size,omitempty"`
+	GapSize                  *uint32 `json:"gap_size,omitempty"`
+	StringArrayVariablesSize *uint32 `json:"string_array_variables_size,omitempty"`
+	// ArrayName is set for array files (see FileEntry.ArrayName).
+	ArrayName string `json:"array_name,omitempty"`
+	// ScreenMode is set for SCREEN$ files (see FileEntry.ScreenMode).
+	ScreenMode int `json:"screen_mode,omitempty"`
+}
+
+// List returns a ListEntry for every used directory slot, in slot
+// order: the rows of `samfile ls`, for callers that want the listing
+// as data rather than printed.
+func (dj *DiskJournal) List() []*ListEntry {
+	entries := []*ListEntry{}
+	for _, slot := range dj.UsedFileEntries() {
+		fe := dj[slot]
+		entry := &ListEntry{
+			Slot:        slot,
+			Name:        fe.Name.String(),
+			Type:        fe.Type.String(),
+			Attributes:  []string{},
+			Sectors:     int(fe.Sectors),
+			FirstTrack:  int(fe.FirstSector.Track),
+			FirstSector: int(fe.FirstSector.Sector),
+			Start:       fe.StartAddress(),
+			Length:      fe.Length(),
+		}
+		if fe.Attributes != 0 {
+			entry.Attributes = strings.Split(fe.Attributes.String(), ", ")
+		}
+		switch fe.Type {
+		case FT_ZX_SNAPSHOT:
+			entry.Start = 0
+			entry.Length = SnapshotLength
+		case FT_CODE:
+			if fe.ExecutionAddressDiv16K != 0xff {
+				address := fe.ExecutionAddress()
+				entry.ExecutionAddress = &address
+			}
+		case FT_SAM_BASIC:
+			if fe.ExecutionAddressDiv16K != 0xff {
+				line := fe.SAMBASICStartLine
+				entry.StartLine = &line
+			}
+			programLength := fe.ProgramLength()
+			numericVariablesSize := fe.NumericVariablesSize()
+			gapSize := fe.GapSize()
+			stringArrayVariablesSize := fe.StringArrayVariablesSize()
+			entry.ProgramLength = &programLength
+			entry.NumericVariablesSize = &numericVariablesSize
+			entry.GapSize = &gapSize
+			entry.StringArrayVariablesSize = &stringArrayVariablesSize
+		case FT_NUM_ARRAY, FT_STR_ARRAY:
+			entry.ArrayName = fe.ArrayName()
+		case FT_SCREEN:
+			entry.ScreenMode = fe.ScreenMode()
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,34 @@
+package samfile
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	di := testImage(t)
+	entries := di.DiskJournal().List()
+	if len(entries) != 35 {
+		t.Fatalf("expected 35 entries but got %v", len(entries))
+	}
+	autoET := entries[1]
+	if autoET.Slot != 1 || autoET.Name != "AUTO-ET" || autoET.Type != "SAM BASIC" || autoET.Sectors != 3 || autoET.FirstTrack != 10 || autoET.FirstSector != 5 || autoET.Start != 0x5cd5 || autoET.Length != 1013 {
+		t.Errorf("unexpected entry %+v", autoET)
+	}
+	if !reflect.DeepEqual(autoET.Attributes, []string{"PROTECTED"}) {
+		t.Errorf("unexpected attributes %v", autoET.Attributes)
+	}
+	if autoET.StartLine == nil || *autoET.StartLine != 0 || autoET.ExecutionAddress != nil {
+		t.Errorf("expected AUTO-ET to auto-RUN from line 0")
+	}
+	if *autoET.ProgramLength != 409 || *autoET.NumericVariablesSize != 92 || *autoET.GapSize != 512 || *autoET.StringArrayVariablesSize != 0 {
+		t.Errorf("unexpected BASIC section sizes %v, %v, %v, %v", *autoET.ProgramLength, *autoET.NumericVariablesSize, *autoET.GapSize, *autoET.StringArrayVariablesSize)
+	}
+	if entries[28].Name != "PRINTSONG" || entries[28].StartLine != nil {
+		t.Errorf("expected PRINTSONG not to auto-RUN")
+	}
+	code := entries[13]
+	if code.Type != "Code" || len(code.Attributes) != 0 || code.ExecutionAddress != nil || code.ProgramLength != nil || code.Length != 78626 {
+		t.Errorf("unexpected entry %+v", code)
+	}
+}
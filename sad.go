@@ -0,0 +1,65 @@
+package samfile
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// SimCoupé SAD image layout: a 22-byte header holding the signature
+// "Aley's disk backup" followed by one byte each for the number of
+// sides, the number of tracks per side, the number of sectors per
+// track, and the sector size divided by 64. Sector data follows the
+// header side by side, then track by track, then sector by sector —
+// i.e. all of side 0 precedes all of side 1, unlike MGT's
+// cylinder-interleaved layout.
+const sadHeaderSize = 22
+
+var sadMagic = []byte("Aley's disk backup")
+
+// DiskImageFromSAD converts the contents of a SimCoupé SAD image file
+// to a DiskImage. The image must use SAM geometry: 1 or 2 sides, at
+// most 80 tracks per side, 10 sectors per track and 512-byte sectors.
+// Tracks or sides not present in the SAD image are left zero-filled.
+func DiskImageFromSAD(data []byte) (*DiskImage, error) {
+	if len(data) < sadHeaderSize || !bytes.EqualFold(data[:len(sadMagic)], sadMagic) {
+		return nil, fmt.Errorf("not a SAD image: missing %q header", sadMagic)
+	}
+	sides := int(data[18])
+	tracks := int(data[19])
+	sectors := int(data[20])
+	sectorSize := int(data[21]) * 64
+	if sides < 1 || sides > 2 || tracks > 80 || sectors != 10 || sectorSize != 512 {
+		return nil, fmt.Errorf("SAD image has %v sides × %v tracks × %v sectors × %v bytes; SAM disks have up to 2 sides × 80 tracks × 10 sectors × 512 bytes", sides, tracks, sectors, sectorSize)
+	}
+	if want := sadHeaderSize + sides*tracks*sectors*sectorSize; len(data) < want {
+		return nil, fmt.Errorf("SAD image truncated: expected %v bytes but file is only %v bytes", want, len(data))
+	}
+	d := DiskImage{}
+	offset := sadHeaderSize
+	for side := 0; side < sides; side++ {
+		for track := 0; track < tracks; track++ {
+			start := (&Sector{Track: uint8(track | side<<7), Sector: 1}).Offset()
+			copy(d[start:start+10*512], data[offset:])
+			offset += 10 * 512
+		}
+	}
+	return &d, nil
+}
+
+// SAD encodes di as a SimCoupé SAD image file with 2 sides × 80
+// tracks × 10 sectors × 512 bytes. Inverse of DiskImageFromSAD.
+func (di *DiskImage) SAD() []byte {
+	out := make([]byte, sadHeaderSize, sadHeaderSize+len(di))
+	copy(out, sadMagic)
+	out[18] = 2
+	out[19] = 80
+	out[20] = 10
+	out[21] = 512 / 64
+	for side := 0; side < 2; side++ {
+		for track := 0; track < 80; track++ {
+			start := (&Sector{Track: uint8(track | side<<7), Sector: 1}).Offset()
+			out = append(out, di[start:start+10*512]...)
+		}
+	}
+	return out
+}
@@ -0,0 +1,61 @@
+package samfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSADRoundTrip(t *testing.T) {
+	di, err := Load(filepath.Join("testdata", "ETrackerv1.2.mgt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sad := di.SAD()
+	if len(sad) != 22+819200 {
+		t.Fatalf("unexpected SAD size %v", len(sad))
+	}
+	// Side 1 of the SAD image starts after all 80 tracks of side 0.
+	side1 := (&Sector{Track: 128, Sector: 1}).Offset()
+	if string(sad[22+80*10*512:22+80*10*512+512]) != string(di[side1:side1+512]) {
+		t.Errorf("SAD image is not laid out side by side")
+	}
+
+	filename := filepath.Join(t.TempDir(), "image.sad")
+	if err := os.WriteFile(filename, sad, 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, container, err := LoadContainer(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if container.Format != FORMAT_SAD || *loaded != *di {
+		t.Fatalf("LoadContainer returned format %v and a different image", container.Format)
+	}
+	if err := loaded.SaveContainer(filename, container); err != nil {
+		t.Fatal(err)
+	}
+	if saved, err := os.ReadFile(filename); err != nil || string(saved) != string(sad) {
+		t.Errorf("SaveContainer did not write the image back as SAD")
+	}
+	if err := os.WriteFile(filename, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	if saved, err := os.ReadFile(filename); err != nil || string(saved) != string(sad) {
+		t.Errorf("Save did not write a .sad file as SAD")
+	}
+}
+
+func TestSADRejectsNonSAMGeometry(t *testing.T) {
+	sad := NewDiskImage().SAD()
+	sad[20] = 9
+	if _, err := DiskImageFromSAD(sad); err == nil {
+		t.Errorf("expected error for 9 sectors per track")
+	}
+	if _, err := DiskImageFromSAD(NewDiskImage().SAD()[:1000]); err == nil {
+		t.Errorf("expected error for truncated image")
+	}
+}
@@ -0,0 +1,484 @@
+package sambasic
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SAM BASIC keeps string and array variables in the SAVARS area. Each
+// starts with an 11-byte header: a type/length byte, whose low 5 bits
+// are the name length, whose bits 5 and 6 give the variable type (see
+// the VT_* constants) and whose bit 7 is set while the variable is
+// hidden (see StringVariable), followed by a 10-byte name field of
+// which only the first name-length bytes are meaningful. A 3-byte
+// length (a page byte then a 16-bit offset, little endian) follows,
+// then the variable's contents.
+//
+// An array's contents are a dimension count, each dimension as a
+// 16-bit little endian size, and the elements in row-major order: 5
+// bytes each (see DecodeNumber) for numeric arrays, 1 byte each for
+// string arrays. As on the ZX Spectrum, the last dimension of a string
+// array is the fixed length of its strings, so DIM a$(3,8) holds three
+// 8-character strings. SAVE ... DATA writes an array's contents as the
+// file body and its 11-byte header as the directory entry's
+// FileTypeInfo.
+const (
+	VT_STRING     = uint8(0x00)
+	VT_NUM_ARRAY  = uint8(0x20)
+	VT_STR_ARRAY  = uint8(0x40)
+	vtMask        = uint8(0x60)
+	vtHidden      = uint8(0x80)
+	vtNameMask    = uint8(0x1f)
+	maxNameLength = 10
+)
+
+// Array is a decoded SAM BASIC numeric or string array.
+type Array struct {
+	// Name is the array's name, without a trailing '$'.
+	Name string
+	// StringArray is true for string arrays, false for numeric
+	// arrays.
+	StringArray bool
+	// Dimensions are the sizes given to DIM. For string arrays the
+	// last dimension is the length of each string.
+	Dimensions []int
+	// Numbers holds the elements of a numeric array in row-major
+	// order.
+	Numbers []float64
+	// Strings holds the strings of a string array in row-major order.
+	Strings []string
+}
+
+// VariableName returns the name of the variable described by header, an
+// 11-byte string or array variable header (such as the FileTypeInfo of
+// an array file): the first name-length bytes of its name field.
+func VariableName(header [11]byte) string {
+	length := int(header[0] & vtNameMask)
+	if length > maxNameLength {
+		length = maxNameLength
+	}
+	return string(header[1 : 1+length])
+}
+
+// DecodeArray decodes data, the contents of a SAM BASIC array called
+// name (a dimension count, the dimensions, then the elements), as a
+// string array if isString is set or otherwise as a numeric array.
+// It returns the array and the number of bytes of data it occupies.
+// Returns an error if data is too short to hold the elements its
+// dimensions call for, however large they are.
+func DecodeArray(name string, isString bool, data []byte) (*Array, int, error) {
+	if len(data) < 1 {
+		return nil, 0, fmt.Errorf("array %v has no dimension count", name)
+	}
+	count := int(data[0])
+	if count == 0 {
+		return nil, 0, fmt.Errorf("array %v has no dimensions", name)
+	}
+	offset := 1 + 2*count
+	if len(data) < offset {
+		return nil, 0, fmt.Errorf("array %v has %v dimensions but only %v bytes", name, count, len(data))
+	}
+	array := &Array{Name: name, StringArray: isString, Dimensions: make([]int, count)}
+	for i := range array.Dimensions {
+		array.Dimensions[i] = int(data[1+2*i]) | int(data[2+2*i])<<8
+	}
+	elements := 1
+	for _, dimension := range array.Dimensions {
+		// Every element takes at least a byte, so stop before the
+		// product can overflow.
+		if dimension != 0 && elements > (len(data)-offset)/dimension {
+			return nil, 0, fmt.Errorf("array %v%v has more elements than the %v bytes that remain", name, array.dimensionText(), len(data)-offset)
+		}
+		elements *= dimension
+	}
+	size := elements
+	if !isString {
+		size *= 5
+	}
+	if len(data) < offset+size {
+		return nil, 0, fmt.Errorf("array %v%v needs %v bytes of elements but only %v remain", name, array.dimensionText(), size, len(data)-offset)
+	}
+	elementData := data[offset : offset+size]
+	if isString {
+		length := array.Dimensions[count-1]
+		array.Strings = make([]string, array.count())
+		for i := range array.Strings {
+			array.Strings[i] = string(elementData[i*length : (i+1)*length])
+		}
+	} else {
+		array.Numbers = make([]float64, elements)
+		for i := range array.Numbers {
+			array.Numbers[i] = DecodeNumber(*(*[5]byte)(elementData[5*i:]))
+		}
+	}
+	return array, offset + size, nil
+}
+
+// count returns the number of values (numbers or strings) in a.
+func (a *Array) count() int {
+	count := 1
+	for _, dimension := range a.shape() {
+		count *= dimension
+	}
+	return count
+}
+
+// shape returns the dimensions indexing the array's values: all of
+// them for numeric arrays, all but the string length for string
+// arrays.
+func (a *Array) shape() []int {
+	if a.StringArray {
+		return a.Dimensions[:len(a.Dimensions)-1]
+	}
+	return a.Dimensions
+}
+
+// dimensionText formats the dimensions as they would be given to DIM,
+// e.g. "(3,4)".
+func (a *Array) dimensionText() string {
+	text := "("
+	for i, dimension := range a.Dimensions {
+		if i > 0 {
+			text += ","
+		}
+		text += strconv.Itoa(dimension)
+	}
+	return text + ")"
+}
+
+// String returns the array's name and dimensions as they would be given
+// to DIM, e.g. "a$(3,8)".
+func (a *Array) String() string {
+	name := a.Name
+	if a.StringArray {
+		name += "$"
+	}
+	return name + a.dimensionText()
+}
+
+// value returns the i-th value of a as a JSON-encodable value.
+func (a *Array) value(i int) any {
+	if a.StringArray {
+		return a.Strings[i]
+	}
+	return a.Numbers[i]
+}
+
+// nested returns the values of a nested by shape, e.g. [[1,2],[3,4]]
+// for a 2×2 array. A string array with only a length dimension has a
+// single string as its value.
+func (a *Array) nested(shape []int, offset int) (any, int) {
+	if len(shape) == 0 {
+		return a.value(offset), offset + 1
+	}
+	values := make([]any, shape[0])
+	for i := range values {
+		values[i], offset = a.nested(shape[1:], offset)
+	}
+	return values, offset
+}
+
+// MarshalJSON encodes a as an object holding its name, type,
+// dimensions and values, with the values nested one JSON array per
+// dimension (excluding the string length of string arrays).
+func (a *Array) MarshalJSON() ([]byte, error) {
+	values, _ := a.nested(a.shape(), 0)
+	arrayType := "numeric"
+	if a.StringArray {
+		arrayType = "string"
+	}
+	return json.Marshal(struct {
+		Name       string `json:"name"`
+		Type       string `json:"type"`
+		Dimensions []int  `json:"dimensions"`
+		Values     any    `json:"values"`
+	}{a.Name, arrayType, a.Dimensions, values})
+}
+
+// WriteCSV writes the values of a to w as CSV. Arrays with one
+// dimension (excluding the string length of string arrays) are written
+// one value per line; otherwise each line holds one run of the last
+// dimension, with earlier dimensions flattened in row-major order.
+func (a *Array) WriteCSV(w io.Writer) error {
+	columns := 1
+	if shape := a.shape(); len(shape) > 1 {
+		columns = shape[len(shape)-1]
+	}
+	writer := csv.NewWriter(w)
+	record := []string{}
+	for i := 0; i < a.count(); i++ {
+		if a.StringArray {
+			record = append(record, a.Strings[i])
+		} else {
+			record = append(record, formatNumber(a.Numbers[i]))
+		}
+		if len(record) == columns {
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+			record = record[:0]
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// maxArraySize is the largest array contents accepted by Bytes: the
+// SAM's 512K of memory.
+const maxArraySize = 1 << 19
+
+// NewArray returns an array called name holding values, either
+// []float64 (a numeric array) or []string (a string array), laid out
+// as a nested JSON-style structure: one level of []any per dimension
+// (excluding the string length of string arrays), or a single value
+// for a string array of one string. dimensions are the sizes to give
+// DIM; if nil they are taken from the shape of values (and, for string
+// arrays, the length of the longest string). Strings shorter than the
+// string length are padded with spaces, as DIM does.
+//
+// Returns an error if values is not rectangular, holds values of the
+// wrong type, or doesn't match dimensions.
+func NewArray(name string, stringArray bool, dimensions []int, values any) (*Array, error) {
+	array := &Array{Name: name, StringArray: stringArray}
+	// The shape is taken from the first element at each depth; every
+	// other element must then match it.
+	shape := []int{}
+	for v := values; ; {
+		list, ok := v.([]any)
+		if !ok {
+			break
+		}
+		shape = append(shape, len(list))
+		if len(list) == 0 {
+			break
+		}
+		v = list[0]
+	}
+	longest := 0
+	var flatten func(value any, depth int) error
+	flatten = func(value any, depth int) error {
+		list, isList := value.([]any)
+		switch {
+		case depth < len(shape) && !isList:
+			return fmt.Errorf("array %v is not rectangular: expected a list of %v values at depth %v but found %v", name, shape[depth], depth+1, value)
+		case depth < len(shape) && len(list) != shape[depth]:
+			return fmt.Errorf("array %v is not rectangular: dimension %v has both %v and %v elements", name, depth+1, shape[depth], len(list))
+		case depth < len(shape):
+			for _, v := range list {
+				if err := flatten(v, depth+1); err != nil {
+					return err
+				}
+			}
+			return nil
+		case isList:
+			return fmt.Errorf("array %v is not rectangular: values nested deeper in some places than others", name)
+		}
+		switch v := value.(type) {
+		case float64:
+			if stringArray {
+				return fmt.Errorf("string array %v holds number %v", name, v)
+			}
+			array.Numbers = append(array.Numbers, v)
+		case string:
+			if !stringArray {
+				return fmt.Errorf("numeric array %v holds string %q", name, v)
+			}
+			if len(v) > longest {
+				longest = len(v)
+			}
+			array.Strings = append(array.Strings, v)
+		default:
+			return fmt.Errorf("array %v holds unsupported value %v", name, value)
+		}
+		return nil
+	}
+	if err := flatten(values, 0); err != nil {
+		return nil, err
+	}
+	if stringArray {
+		shape = append(shape, longest)
+	}
+	if dimensions == nil {
+		dimensions = shape
+	}
+	if len(dimensions) != len(shape) {
+		return nil, fmt.Errorf("array %v has %v dimensions but its values have %v", name, len(dimensions), len(shape))
+	}
+	for i, dimension := range dimensions {
+		if stringArray && i == len(dimensions)-1 {
+			if longest > dimension {
+				return nil, fmt.Errorf("string array %v has strings of length %v but dimensions set a length of %v", name, longest, dimension)
+			}
+		} else if dimension != shape[i] {
+			return nil, fmt.Errorf("array %v has dimension %v of size %v but its values have %v", name, i+1, dimension, shape[i])
+		}
+	}
+	array.Dimensions = append([]int(nil), dimensions...)
+	if stringArray {
+		length := dimensions[len(dimensions)-1]
+		for i, s := range array.Strings {
+			array.Strings[i] = s + strings.Repeat(" ", length-len(s))
+		}
+	}
+	return array, nil
+}
+
+// ReadArrayJSON reads an array called name from r, as either the
+// object written by Array.MarshalJSON (whose "name" and "type" are
+// ignored in favour of name and stringArray) or just its nested
+// "values". See NewArray.
+func ReadArrayJSON(r io.Reader, name string, stringArray bool) (*Array, error) {
+	var value any
+	if err := json.NewDecoder(r).Decode(&value); err != nil {
+		return nil, err
+	}
+	var dimensions []int
+	if object, ok := value.(map[string]any); ok {
+		values, ok := object["values"]
+		if !ok {
+			return nil, fmt.Errorf("JSON object has no \"values\"")
+		}
+		if d, ok := object["dimensions"]; ok {
+			list, ok := d.([]any)
+			if !ok {
+				return nil, fmt.Errorf("JSON \"dimensions\" is not a list")
+			}
+			for _, v := range list {
+				dimension, ok := v.(float64)
+				if !ok || dimension != float64(int(dimension)) {
+					return nil, fmt.Errorf("JSON \"dimensions\" holds %v, which is not a whole number", v)
+				}
+				dimensions = append(dimensions, int(dimension))
+			}
+		}
+		value = values
+	}
+	return NewArray(name, stringArray, dimensions, value)
+}
+
+// ReadArrayCSV reads an array called name from CSV data in r, as
+// written by Array.WriteCSV: a one-dimensional array if each line has
+// a single field, otherwise a two-dimensional array with one row per
+// line. Numeric fields are parsed with strconv.ParseFloat.
+func ReadArrayCSV(r io.Reader, name string, stringArray bool) (*Array, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 0
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("CSV has no rows")
+	}
+	rows := []any{}
+	for i, record := range records {
+		row := []any{}
+		for j, field := range record {
+			if stringArray {
+				row = append(row, field)
+				continue
+			}
+			f, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				return nil, fmt.Errorf("CSV row %v column %v: %q is not a number", i+1, j+1, field)
+			}
+			row = append(row, f)
+		}
+		rows = append(rows, row)
+	}
+	if len(records[0]) == 1 {
+		for i, row := range rows {
+			rows[i] = row.([]any)[0]
+		}
+	}
+	return NewArray(name, stringArray, nil, rows)
+}
+
+// Header returns the 11-byte variable header of a (see VariableName),
+// as stored in the FileTypeInfo of an array file. The name is stored
+// in lower case, as SAM BASIC stores it. Returns an error if the name
+// is not a valid SAM BASIC array name: a letter followed by up to 9
+// letters, digits or underscores.
+func (a *Array) Header() ([11]byte, error) {
+	header := [11]byte{}
+	if len(a.Name) < 1 || len(a.Name) > maxNameLength {
+		return header, fmt.Errorf("array name %q must be 1 to %v characters", a.Name, maxNameLength)
+	}
+	for i, c := range strings.ToLower(a.Name) {
+		switch {
+		case c >= 'a' && c <= 'z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '_'):
+		default:
+			return header, fmt.Errorf("array name %q must be a letter followed by letters, digits or underscores", a.Name)
+		}
+	}
+	header[0] = VT_NUM_ARRAY
+	if a.StringArray {
+		header[0] = VT_STR_ARRAY
+	}
+	header[0] |= uint8(len(a.Name))
+	copy(header[1:], strings.ToLower(a.Name)+strings.Repeat(" ", maxNameLength))
+	return header, nil
+}
+
+// Bytes encodes the contents of a (the inverse of DecodeArray): the
+// dimension count, the dimensions and the elements. Returns an error
+// if a can't be represented by SAM BASIC: no dimensions or more than
+// 255, a dimension outside 1–65535, elements that don't match the
+// dimensions, numbers SAM can't store, or contents larger than the
+// SAM's memory.
+func (a *Array) Bytes() ([]byte, error) {
+	if len(a.Dimensions) < 1 || len(a.Dimensions) > 255 {
+		return nil, fmt.Errorf("array %v has %v dimensions; SAM BASIC arrays have 1 to 255", a, len(a.Dimensions))
+	}
+	size := 1
+	for _, dimension := range a.Dimensions {
+		if dimension < 1 || dimension > 0xFFFF {
+			return nil, fmt.Errorf("array %v has dimension %v; SAM BASIC dimensions are 1 to 65535", a, dimension)
+		}
+		size *= dimension
+		if size > maxArraySize {
+			return nil, fmt.Errorf("array %v is larger than the SAM's %vK of memory", a, maxArraySize>>10)
+		}
+	}
+	if !a.StringArray {
+		size *= 5
+	}
+	out := make([]byte, 1+2*len(a.Dimensions), 1+2*len(a.Dimensions)+size)
+	if len(out)+size > maxArraySize {
+		return nil, fmt.Errorf("array %v is larger than the SAM's %vK of memory", a, maxArraySize>>10)
+	}
+	out[0] = byte(len(a.Dimensions))
+	for i, dimension := range a.Dimensions {
+		out[1+2*i] = byte(dimension)
+		out[2+2*i] = byte(dimension >> 8)
+	}
+	if a.StringArray {
+		length := a.Dimensions[len(a.Dimensions)-1]
+		if len(a.Strings) != a.count() {
+			return nil, fmt.Errorf("array %v needs %v strings but has %v", a, a.count(), len(a.Strings))
+		}
+		for _, s := range a.Strings {
+			if len(s) != length {
+				return nil, fmt.Errorf("array %v holds string %q which is not %v characters long", a, s, length)
+			}
+			out = append(out, s...)
+		}
+		return out, nil
+	}
+	if len(a.Numbers) != a.count() {
+		return nil, fmt.Errorf("array %v needs %v numbers but has %v", a, a.count(), len(a.Numbers))
+	}
+	for _, f := range a.Numbers {
+		fp, err := EncodeNumber(f)
+		if err != nil {
+			return nil, fmt.Errorf("array %v: %v", a, err)
+		}
+		out = append(out, fp[:]...)
+	}
+	return out, nil
+}
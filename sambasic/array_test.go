@@ -0,0 +1,191 @@
+package sambasic
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeNumericArray(t *testing.T) {
+	// DIM a(2,3) with a(r,c) = 10*r + c, then -1.5 at a(2,3).
+	data := []byte{2, 2, 0, 3, 0}
+	for r := 1; r <= 2; r++ {
+		for c := 1; c <= 3; c++ {
+			data = append(data, 0, 0, byte(10*r+c), 0, 0)
+		}
+	}
+	copy(data[len(data)-5:], []byte{0x81, 0xC0, 0, 0, 0})
+	data = append(data, 0xAA)
+	array, size, err := DecodeArray("a", false, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != len(data)-1 {
+		t.Errorf("expected array to occupy %v bytes, got %v", len(data)-1, size)
+	}
+	if array.String() != "a(2,3)" {
+		t.Errorf("expected a(2,3), got %v", array)
+	}
+	j, err := json.Marshal(array)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"name":"a","type":"numeric","dimensions":[2,3],"values":[[11,12,13],[21,22,-1.5]]}`; string(j) != want {
+		t.Errorf("expected JSON %v, got %s", want, j)
+	}
+	var buf bytes.Buffer
+	if err := array.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := "11,12,13\n21,22,-1.5\n"; buf.String() != want {
+		t.Errorf("expected CSV %q, got %q", want, buf.String())
+	}
+}
+
+func TestDecodeStringArray(t *testing.T) {
+	data := append([]byte{2, 3, 0, 4, 0}, "one two,six "...)
+	array, _, err := DecodeArray("names", true, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if array.String() != "names$(3,4)" {
+		t.Errorf("expected names$(3,4), got %v", array)
+	}
+	j, err := json.Marshal(array)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"name":"names","type":"string","dimensions":[3,4],"values":["one ","two,","six "]}`; string(j) != want {
+		t.Errorf("expected JSON %v, got %s", want, j)
+	}
+	var buf bytes.Buffer
+	if err := array.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := "one \n\"two,\"\nsix \n"; buf.String() != want {
+		t.Errorf("expected CSV %q, got %q", want, buf.String())
+	}
+
+	// A one-dimensional string array is a single fixed-length string.
+	array, _, err = DecodeArray("s", true, append([]byte{1, 5, 0}, "hello"...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j, _ := json.Marshal(array); string(j) != `{"name":"s","type":"string","dimensions":[5],"values":"hello"}` {
+		t.Errorf("unexpected JSON %s", j)
+	}
+}
+
+func TestDecodeArrayErrors(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":              {},
+		"no dimensions":      {0},
+		"truncated header":   {2, 1, 0},
+		"truncated elements": {1, 2, 0, 0, 0, 1, 0, 0},
+		"huge dimensions":    {4, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0},
+	} {
+		if _, _, err := DecodeArray("a", false, data); err == nil {
+			t.Errorf("%v: expected error", name)
+		}
+	}
+}
+
+func TestVariableName(t *testing.T) {
+	header := [11]byte{VT_STR_ARRAY | 1}
+	copy(header[1:], "nptersbles")
+	if name := VariableName(header); name != "n" {
+		t.Errorf("expected n, got %q", name)
+	}
+}
+
+func TestArrayRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		json   string
+		csv    string
+		string bool
+		text   string
+	}{
+		{json: `[[1,2,3],[4,5,-6.5]]`, csv: "1,2,3\n4,5,-6.5\n", text: "a(2,3)"},
+		{json: `[0.25,65535,-65535,-1e9]`, csv: "0.25\n65535\n-65535\n-1e9\n", text: "a(4)"},
+		{json: `["cat","mouse"]`, csv: "cat\nmouse\n", string: true, text: "a$(2,5)"},
+		{json: `"hello"`, string: true, text: "a$(5)"},
+	} {
+		fromJSON, err := ReadArrayJSON(strings.NewReader(test.json), "a", test.string)
+		if err != nil {
+			t.Fatalf("%v: %v", test.json, err)
+		}
+		if fromJSON.String() != test.text {
+			t.Errorf("%v: expected %v, got %v", test.json, test.text, fromJSON)
+		}
+		if test.csv != "" {
+			fromCSV, err := ReadArrayCSV(strings.NewReader(test.csv), "a", test.string)
+			if err != nil {
+				t.Fatalf("%q: %v", test.csv, err)
+			}
+			if !reflect.DeepEqual(fromCSV, fromJSON) {
+				t.Errorf("%q: CSV gave %#v but JSON gave %#v", test.csv, fromCSV, fromJSON)
+			}
+		}
+		header, err := fromJSON.Header()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := fromJSON.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, n, err := DecodeArray(VariableName(header), test.string, data)
+		if err != nil {
+			t.Fatalf("%v: %v", test.json, err)
+		}
+		if n != len(data) || !reflect.DeepEqual(decoded, fromJSON) {
+			t.Errorf("%v: round trip gave %#v (%v bytes), expected %#v (%v bytes)", test.json, decoded, n, fromJSON, len(data))
+		}
+		out, err := json.Marshal(decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := ReadArrayJSON(bytes.NewReader(out), "a", test.string)
+		if err != nil || !reflect.DeepEqual(again, fromJSON) {
+			t.Errorf("%s: reading back MarshalJSON output gave %#v, %v", out, again, err)
+		}
+	}
+}
+
+func TestArrayValidation(t *testing.T) {
+	for _, test := range []struct {
+		json   string
+		string bool
+		name   string
+	}{
+		{json: `[[1,2],[3]]`, name: "a"},
+		{json: `[[1,2],3]`, name: "a"},
+		{json: `[1,"x"]`, name: "a"},
+		{json: `["x",1]`, string: true, name: "a"},
+		{json: `[1,null]`, name: "a"},
+		{json: `[]`, name: "a"},
+		{json: `[1e300]`, name: "a"},
+		{json: `{"dimensions":[3],"values":[1,2]}`, name: "a"},
+		{json: `{"dimensions":[2,2],"values":["abc","d"]}`, string: true, name: "a"},
+		{json: `[1]`, name: "1a"},
+		{json: `[1]`, name: "abcdefghijk"},
+		{json: `[1]`, name: "a b"},
+	} {
+		array, err := ReadArrayJSON(strings.NewReader(test.json), test.name, test.string)
+		if err == nil {
+			_, err = array.Bytes()
+		}
+		if err == nil {
+			_, err = array.Header()
+		}
+		if err == nil {
+			t.Errorf("%v (name %q): expected an error", test.json, test.name)
+		}
+	}
+	big := &Array{Name: "a", Dimensions: []int{1000, 1000}}
+	if _, err := big.Bytes(); err == nil {
+		t.Errorf("expected an error for an array larger than memory")
+	}
+}
@@ -2,6 +2,7 @@ package sambasic
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -167,3 +168,36 @@ func encodeFloatToSAM(f float64) ([5]byte, error) {
 	out[4] = byte(mant)
 	return out, nil
 }
+
+// DecodeNumber returns the value of fp, a number in SAM's 5-byte
+// floating-point form as stored in variables and DATA arrays. Besides
+// the general normalised form it accepts the small-integer form {0x00,
+// sign, LSB, MSB, 0x00}, where sign 0xFF marks a negative value held
+// as LSB/MSB two's complement (as on the ZX Spectrum).
+func DecodeNumber(fp [5]byte) float64 {
+	if fp[0] == 0x00 && fp[1] == 0xFF && fp[4] == 0x00 {
+		return float64(int(fp[2])|int(fp[3])<<8) - 65536
+	}
+	v, _ := decodeFP5(fp[:])
+	return v
+}
+
+// EncodeNumber returns f in SAM's 5-byte floating-point form, the
+// inverse of DecodeNumber. Whole numbers in 0..65535 use the
+// small-integer form, as the ROM does for numeric literals; other
+// values use the general normalised form. Returns an error if f is
+// not finite or its magnitude is outside the range SAM can represent.
+func EncodeNumber(f float64) ([5]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return [5]byte{}, fmt.Errorf("%v is not a number SAM BASIC can store", f)
+	}
+	if f >= 0 && f <= 0xFFFF && f == math.Trunc(f) {
+		v := uint16(f)
+		return [5]byte{0x00, 0x00, byte(v), byte(v >> 8), 0x00}, nil
+	}
+	fp, err := encodeFloatToSAM(f)
+	if err != nil {
+		return fp, fmt.Errorf("%v is out of range for SAM BASIC: %v", f, err)
+	}
+	return fp, nil
+}
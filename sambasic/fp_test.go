@@ -1,6 +1,7 @@
 package sambasic
 
 import (
+	"math"
 	"testing"
 )
 
@@ -94,3 +95,40 @@ func TestEncodeFP_GeneralForm(t *testing.T) {
 		})
 	}
 }
+
+func TestDecodeNumber(t *testing.T) {
+	tests := []struct {
+		in   [5]byte
+		want float64
+	}{
+		{[5]byte{0x00, 0x00, 0x00, 0x00, 0x00}, 0},
+		{[5]byte{0x00, 0x00, 0x34, 0x12, 0x00}, 0x1234},
+		{[5]byte{0x00, 0xFF, 0xFF, 0xFF, 0x00}, -1},
+		{[5]byte{0x00, 0xFF, 0x00, 0x80, 0x00}, -32768},
+		{[5]byte{0x81, 0x40, 0x00, 0x00, 0x00}, 1.5},
+		{[5]byte{0x81, 0xC0, 0x00, 0x00, 0x00}, -1.5},
+		{[5]byte{0x7F, 0x00, 0x00, 0x00, 0x00}, 0.25},
+	}
+	for _, tt := range tests {
+		if got := DecodeNumber(tt.in); got != tt.want {
+			t.Errorf("DecodeNumber(% X) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeNumberRoundTrip(t *testing.T) {
+	for _, f := range []float64{0, 1, 65535, 65536, -1, -65536, 0.5, -0.25, 3.75, 1e30, -1e-30} {
+		fp, err := EncodeNumber(f)
+		if err != nil {
+			t.Fatalf("EncodeNumber(%v): %v", f, err)
+		}
+		if got := DecodeNumber(fp); !floatNearlyEqual(got, f) {
+			t.Errorf("EncodeNumber(%v) = % X decodes to %v", f, fp, got)
+		}
+	}
+	for _, f := range []float64{math.NaN(), math.Inf(1), 1e300} {
+		if _, err := EncodeNumber(f); err == nil {
+			t.Errorf("EncodeNumber(%v): expected error", f)
+		}
+	}
+}
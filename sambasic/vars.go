@@ -0,0 +1,250 @@
+package sambasic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SAM BASIC keeps numeric variables in the NVARS area, which starts
+// with a 52-byte table of 26 little endian pointers, one per initial
+// letter a–z, each heading a chain of the variables whose names start
+// with that letter (0xFFFF for none). A pointer stored at offset o
+// points to offset o+1+pointer (a signed 16-bit displacement). Each
+// variable is a type/length byte (the low 5 bits are the name length
+// less one; bit 6 is set for FOR loop control variables), a pointer
+// to the next variable in the chain, the name without its initial
+// letter, and the 5-byte value. A FOR loop control variable then has
+// its 5-byte limit and step and the place the loop returns to: a REL
+// PAGE FORM address (a page byte then a 16-bit offset, little endian)
+// of the start of the line, and the statement number within it.
+//
+// Strings and arrays are kept in the SAVARS area (see VT_STRING).
+const (
+	nvarsTableSize = 26 * 2
+	nvarsForLoop   = uint8(0x40)
+	nvarsNameMask  = uint8(0x1f)
+	noVariable     = 0xffff
+)
+
+// Variables holds the variables saved with a SAM BASIC program, each
+// kind in the order the program created them.
+type Variables struct {
+	Numbers []*NumericVariable
+	Strings []*StringVariable
+	Arrays  []*Array
+}
+
+// NumericVariable is a simple numeric variable or a FOR loop control
+// variable.
+type NumericVariable struct {
+	Name  string
+	Value float64
+	// For is set if the variable controls a FOR loop.
+	For *ForLoop
+}
+
+// ForLoop is the loop state SAM BASIC keeps with a FOR loop control
+// variable.
+type ForLoop struct {
+	Limit float64
+	Step  float64
+	// Address is the address, in the form of
+	// FileEntry.StartAddress, of the line NEXT loops back to.
+	Address uint32
+	// Line is the number of the line at Address, or 0 if Address
+	// isn't the start of a line of the program.
+	Line uint16
+	// Statement is the number of the statement within the line
+	// that NEXT loops back to.
+	Statement uint8
+}
+
+// StringVariable is a string variable.
+type StringVariable struct {
+	// Name is the variable's name, without the trailing '$'.
+	Name  string
+	Value string
+	// Hidden is set for a variable that can't currently be seen by
+	// name, such as the outer copy of a variable redeclared by
+	// LOCAL or as a procedure parameter.
+	Hidden bool
+}
+
+// DecodeVariables decodes nvars and savars, the NVARS and SAVARS areas
+// saved with SAM BASIC program program, which was saved from address
+// programStart (in the form of FileEntry.StartAddress). program is
+// used to find the line numbers that FOR loops return to. Returns an
+// error if either area is truncated or malformed.
+func DecodeVariables(program []byte, programStart uint32, nvars, savars []byte) (*Variables, error) {
+	v := &Variables{}
+	if err := v.decodeNumbers(nvars); err != nil {
+		return nil, err
+	}
+	for _, n := range v.Numbers {
+		if n.For != nil && n.For.Address >= programStart {
+			n.For.Line = lineStartingAt(program, n.For.Address-programStart)
+		}
+	}
+	if err := v.decodeStringsAndArrays(savars); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// decodeNumbers walks the letter chains of NVARS area nvars. An area
+// of zeros, as File writes by default, holds no variables.
+func (v *Variables) decodeNumbers(nvars []byte) error {
+	if len(nvars) == 0 {
+		return nil
+	}
+	if len(nvars) < nvarsTableSize {
+		return fmt.Errorf("numeric variables area is %v bytes, shorter than its %v byte letter table", len(nvars), nvarsTableSize)
+	}
+	if bytes.Equal(nvars, make([]byte, len(nvars))) {
+		return nil
+	}
+	pointer := func(offset int) int {
+		p := uint16(nvars[offset]) | uint16(nvars[offset+1])<<8
+		if p == noVariable {
+			return -1
+		}
+		return offset + 1 + int(int16(p))
+	}
+	offsets := map[*NumericVariable]int{}
+	for letter := 0; letter < 26; letter++ {
+		visited := map[int]bool{}
+		for offset := pointer(2 * letter); offset >= 0; {
+			if visited[offset] {
+				return fmt.Errorf("numeric variables starting with %q loop back to offset %v", 'a'+letter, offset)
+			}
+			visited[offset] = true
+			if offset < nvarsTableSize || offset+3 > len(nvars) {
+				return fmt.Errorf("numeric variable at offset %v is outside the numeric variables area", offset)
+			}
+			typeByte := nvars[offset]
+			nameEnd := offset + 3 + int(typeByte&nvarsNameMask)
+			size := nameEnd + 5 - offset
+			if typeByte&nvarsForLoop != 0 {
+				size += 14
+			}
+			if offset+size > len(nvars) {
+				return fmt.Errorf("numeric variable at offset %v needs %v bytes but only %v remain", offset, size, len(nvars)-offset)
+			}
+			n := &NumericVariable{
+				Name:  string(rune('a'+letter)) + string(nvars[offset+3:nameEnd]),
+				Value: DecodeNumber(*(*[5]byte)(nvars[nameEnd:])),
+			}
+			if typeByte&nvarsForLoop != 0 {
+				loop := nvars[nameEnd+5:]
+				n.For = &ForLoop{
+					Limit:     DecodeNumber(*(*[5]byte)(loop[0:])),
+					Step:      DecodeNumber(*(*[5]byte)(loop[5:])),
+					Address:   uint32((loop[10]&0x1f)+1)<<14 | (uint32(loop[11])|uint32(loop[12])<<8)&0x3fff,
+					Statement: loop[13],
+				}
+			}
+			v.Numbers = append(v.Numbers, n)
+			offsets[n] = offset
+			offset = pointer(offset + 1)
+		}
+	}
+	sort.SliceStable(v.Numbers, func(i, j int) bool {
+		return offsets[v.Numbers[i]] < offsets[v.Numbers[j]]
+	})
+	return nil
+}
+
+// decodeStringsAndArrays walks the variables of SAVARS area savars.
+func (v *Variables) decodeStringsAndArrays(savars []byte) error {
+	for offset := 0; offset < len(savars); {
+		if offset+14 > len(savars) {
+			return fmt.Errorf("string/array variable at offset %v is truncated", offset)
+		}
+		header := *(*[11]byte)(savars[offset:])
+		name := VariableName(header)
+		length := int(savars[offset+11])<<14 | (int(savars[offset+12])|int(savars[offset+13])<<8)&0x3fff
+		offset += 14
+		if offset+length > len(savars) {
+			return fmt.Errorf("variable %v needs %v bytes but only %v remain", name, length, len(savars)-offset)
+		}
+		contents := savars[offset : offset+length]
+		switch header[0] & vtMask {
+		case VT_STRING:
+			v.Strings = append(v.Strings, &StringVariable{
+				Name:   name,
+				Value:  string(contents),
+				Hidden: header[0]&vtHidden != 0,
+			})
+		case VT_NUM_ARRAY, VT_STR_ARRAY:
+			array, _, err := DecodeArray(name, header[0]&vtMask == VT_STR_ARRAY, contents)
+			if err != nil {
+				return err
+			}
+			v.Arrays = append(v.Arrays, array)
+		default:
+			return fmt.Errorf("variable %v at offset %v has unknown type byte 0x%02x", name, offset-14, header[0])
+		}
+		offset += length
+	}
+	return nil
+}
+
+// lineStartingAt returns the number of the line of program that starts
+// at offset, or 0 if none does.
+func lineStartingAt(program []byte, offset uint32) uint16 {
+	for pos := uint32(0); pos+4 <= uint32(len(program)) && program[pos] != 0xff; {
+		if pos == offset {
+			return uint16(program[pos])<<8 | uint16(program[pos+1])
+		}
+		pos += 4 + (uint32(program[pos+2]) | uint32(program[pos+3])<<8)
+	}
+	return 0
+}
+
+// WriteText writes v to w as text, one variable per line, in the form
+// of a LET or DIM statement: numbers as name=value (followed, for FOR
+// loop control variables, by the limit, step and where NEXT loops
+// back to), strings as name$="value" (with '"' doubled, as in a
+// listing, and followed by "(hidden)" if hidden), and arrays as their
+// DIM followed by their values, nested as in JSON.
+func (v *Variables) WriteText(w io.Writer) error {
+	for _, n := range v.Numbers {
+		text := n.Name + "=" + formatNumber(n.Value)
+		if n.For != nil {
+			text += fmt.Sprintf(" TO %v STEP %v (NEXT loops back to line %v statement %v)", formatNumber(n.For.Limit), formatNumber(n.For.Step), n.For.Line, n.For.Statement)
+		}
+		if _, err := fmt.Fprintln(w, text); err != nil {
+			return err
+		}
+	}
+	for _, s := range v.Strings {
+		text := fmt.Sprintf("%v$=\"%v\"", s.Name, strings.ReplaceAll(s.Value, `"`, `""`))
+		if s.Hidden {
+			text += " (hidden)"
+		}
+		if _, err := fmt.Fprintln(w, text); err != nil {
+			return err
+		}
+	}
+	for _, a := range v.Arrays {
+		values, _ := a.nested(a.shape(), 0)
+		data, err := json.Marshal(values)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "DIM %v=%s\n", a, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatNumber formats f for WriteText and WriteCSV.
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,92 @@
+package sambasic
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testNVARS returns an NVARS area holding x=1 and a FOR loop control
+// variable xy=2 TO 10 STEP 1 returning to address 0x8010 of page 0,
+// statement 2, created in that order.
+func testNVARS() []byte {
+	nvars := bytes.Repeat([]byte{0xff}, 52)
+	// 'x' chain: table entry at 46 points to the FOR variable at 60
+	// (creation order is by offset, not chain order).
+	nvars[46], nvars[47] = 60-47, 0
+	nvars = append(nvars, 0x00, 0xff, 0xff, 0, 0, 1, 0, 0) // x=1 at 52
+	nvars = append(nvars,
+		0x41, 0xf6, 0xff, 'y', // xy, next is x at 52 (62-10)
+		0, 0, 2, 0, 0, // value
+		0, 0, 10, 0, 0, // limit
+		0, 0, 1, 0, 0, // step
+		0x00, 0x10, 0x80, 2, // page, address, statement
+	)
+	return nvars
+}
+
+func TestDecodeVariables(t *testing.T) {
+	// Lines 10 (at offset 0) and 20 (at offset 0x10).
+	program := []byte{0, 10, 12, 0, 'P', 'R', 'I', 'N', 'T', ' ', '1', '2', '3', '4', '5', 0x0d, 0, 20, 1, 0, 0x0d, 0xff}
+	savars := []byte{0x01, 'a', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', 0, 4, 0, 'a', '"', 'b', 'c'}
+	savars = append(savars, 0x82, 'a', 'b', 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 'x')
+	savars = append(savars, VT_STR_ARRAY|1, 'n', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 9, 0, 2, 2, 0, 2, 0, 'a', 'b', 'c', 'd')
+	vars, err := DecodeVariables(program, 0x4000|0x10, testNVARS(), savars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := bytes.Buffer{}
+	if err := vars.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+	// The FOR loop returns to 0x4010 (page 0 offset 0x8010): the
+	// start of line 10 for a program saved from 0x4010, and of line
+	// 20 for one saved from 0x4000.
+	expected := `x=1
+xy=2 TO 10 STEP 1 (NEXT loops back to line 10 statement 2)
+a$="a""bc"
+ab$="x" (hidden)
+DIM n$(2,2)=["ab","cd"]
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%v\ngot:\n%v", expected, out.String())
+	}
+	if loop := vars.Numbers[1].For; loop == nil || loop.Address != 0x4010 {
+		t.Errorf("unexpected FOR loop %+v", loop)
+	}
+	vars, err = DecodeVariables(program, 0x4000, testNVARS(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line := vars.Numbers[1].For.Line; line != 20 {
+		t.Errorf("expected FOR loop to return to line 20, got %v", line)
+	}
+}
+
+func TestDecodeVariablesErrors(t *testing.T) {
+	looping := testNVARS()
+	looping[53], looping[54] = 60-54, 0 // x points back to xy
+	truncated := testNVARS()[:70]
+	for name, test := range map[string]struct{ nvars, savars []byte }{
+		"short table":     {nvars: make([]byte, 10)},
+		"looping chain":   {nvars: looping},
+		"truncated FOR":   {nvars: truncated},
+		"short header":    {savars: []byte{0x01, 'a'}},
+		"truncated value": {savars: []byte{0x01, 'a', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 5, 0, 'x'}},
+		"unknown type":    {savars: []byte{0x61, 'a', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
+	} {
+		if _, err := DecodeVariables(nil, 0, test.nvars, test.savars); err == nil {
+			t.Errorf("%v: expected an error", name)
+		}
+	}
+}
+
+func TestDecodeVariablesDefault(t *testing.T) {
+	// File writes a zeroed numeric variables area by default.
+	vars, err := DecodeVariables(nil, 0x4000, make([]byte, defaultNumericVarsSize), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vars.Numbers) != 0 || len(vars.Strings) != 0 || len(vars.Arrays) != 0 {
+		t.Errorf("expected no variables but got %+v", vars)
+	}
+}
@@ -1,9 +1,12 @@
 // Package samfile reads, inspects and modifies individual files inside a
 // SAM Coupé MGT floppy disk image (the 819200-byte .mgt format written by
-// SAMDOS and used by the SAM emulator ecosystem). For whole-disk
-// operations and format conversions, use samdisk
+// SAMDOS and used by the SAM emulator ecosystem). Extended CPC DSK
+// (EDSK) and SimCoupé SAD images are converted to and from MGT
+// geometry transparently, as are gzip-compressed images and images
+// inside zip archives.
+// For whole-disk operations and other format conversions, use samdisk
 // (https://simonowen.com/samdisk/) instead — samfile only touches the
-// contents of an existing image.
+// contents of an image (or creates an empty, SAMDOS-formatted one).
 //
 // # MGT image layout
 //
@@ -22,20 +25,52 @@
 //
 // # API model
 //
-//   - [Load] reads an .mgt file into a [*DiskImage] (and rejects EDSK
-//     format, which must be converted with samdisk first).
+//   - [Load] reads an .mgt (or EDSK / SAD) file into a [*DiskImage];
+//     [LoadContainer] also reports the file's [Container] format.
 //   - [DiskImage.DiskJournal] parses the 80-slot directory into a
-//     [*DiskJournal] of [*FileEntry].
+//     [*DiskJournal] of [*FileEntry]; [DiskJournal.List] returns its
+//     used entries as [ListEntry] rows.
 //   - [DiskImage.File] walks the sector chain for a named file and
 //     returns its assembled [*File] (9-byte [FileHeader] + body bytes).
+//     Names are matched case-insensitively, as SAMDOS does;
+//     [DiskJournal.Match] expands SAMDOS `*` / `?` wildcards.
+//   - [DiskImage.Map] reports which file owns each data sector, the
+//     free space and how fragmented each file is, as a [DiskMap].
+//   - [Diff] compares the files of two disks.
+//   - [DiskImage.Unpack] writes a disk's files and a [Manifest] of
+//     everything else on it to a directory, from which [Pack] rebuilds
+//     the identical disk.
+//   - [DiskImage.FS] presents the disk's files as an [io/fs.FS].
 //   - [DiskImage.AddCodeFile] writes a new code/data file to a free
 //     slot and free sectors, updating both the directory and the
 //     sector chain.
+//   - [DiskImage.DeleteFile] erases a file, freeing its slot and
+//     sectors; [DiskImage.RenameFile] renames one in place.
+//   - [Build] makes a complete disk from a [BuildSpec] (see
+//     [ReadBuildSpec]).
+//   - [NewDiskImage] returns an empty disk; [DiskImage.SetLabel] labels
+//     it and [DiskImage.InstallDOS] makes it (or any other disk)
+//     bootable; [DiskImage.Bootable] checks whether a disk will boot.
 //   - [DiskImage.Save] writes the (possibly modified) image back to
-//     disk.
+//     disk, in the format the file's extension calls for;
+//     [DiskImage.SaveContainer] writes it in a given format.
+//
+// SCREEN$ files are decoded to images with [DiskImage.Screen] (or
+// [DecodeScreen]), in the SAM's 128-colour palette ([SAMColour]), and
+// images are added as SCREEN$ files with [DiskImage.AddScreenFile] (or
+// encoded with [EncodeScreen]).
+//
+// Arrays saved with SAVE ... DATA are decoded with [DiskImage.Array]
+// into a [sambasic.Array], and written with [DiskImage.AddNumArray],
+// [DiskImage.AddStringArray] or [DiskImage.AddArray].
+//
+// 48K ZX Spectrum snapshots are read with [DiskImage.Snapshot] into a
+// [Snapshot], which converts to and from .sna and .z80 files, and
+// written with [DiskImage.AddSnapshot].
 //
 // SAM BASIC programs are stored tokenised; [SAMBasic.Output]
-// detokenises a body into a plain-text listing.
+// detokenises a body into a plain-text listing, and
+// [DiskImage.Variables] decodes the variables saved with it.
 //
 // Authoritative format references: the SAM Coupé Technical Manual v3.0
 // (https://sam.speccy.cz/systech/sam-coupe_tech-man_v3-0.pdf), the
@@ -59,9 +94,15 @@ type (
 	// value of 0 marks the slot erased; valid file types are listed
 	// in the FT_* constants. SAMDOS also uses bit 7 of this byte for
 	// HIDDEN and bit 6 for PROTECTED — those attribute bits are not
-	// modelled by FileType and must be masked off before comparing.
+	// part of FileType; FileEntryFrom splits them out into
+	// FileEntry.Attributes.
 	FileType uint8
 
+	// FileAttributes holds the HIDDEN and PROTECTED attribute bits
+	// that SAMDOS stores in the top two bits of a directory entry's
+	// status / file-type byte. See the FA_* constants.
+	FileAttributes uint8
+
 	// DiskImage is the raw byte image of one MGT floppy: 80
 	// cylinders × 2 sides × 10 sectors × 512 bytes, stored
 	// cylinder-interleaved (see the package overview). Use Load and
@@ -89,7 +130,10 @@ type (
 	// SAVE time so that LS-style operations don't have to read the
 	// file body. They should always match the body header.
 	FileEntry struct {
-		Type        FileType
+		Type FileType
+		// Attributes holds bits 7 and 6 of the status / file-type
+		// byte (HIDDEN and PROTECTED); Type holds the remaining bits.
+		Attributes  FileAttributes
 		Name        Filename
 		Sectors     uint16 // big-endian on disk: count of 512-byte sectors the file occupies
 		FirstSector *Sector
@@ -99,9 +143,11 @@ type (
 		// FileTypeInfo is the 11-byte type-dependent metadata block
 		// at directory bytes 0xDD–0xE7. For FT_SAM_BASIC it holds
 		// three 3-byte PAGEFORM length triplets (program / +numeric
-		// vars / +gap); for FT_SCREEN, byte 0 is the screen MODE;
+		// vars / +gap); for FT_SCREEN, byte 0 is the screen MODE
+		// less one (see ScreenMode);
 		// for FT_NUM_ARRAY and FT_STR_ARRAY it holds the array's
-		// type/length byte plus name; for FT_CODE it is unused.
+		// type/length byte plus name (see ArrayName); for FT_CODE it
+		// is unused.
 		FileTypeInfo           [11]byte
 		StartAddressPage       uint8  // mirror of FileHeader.StartPage
 		StartAddressPageOffset uint16 // mirror of FileHeader.PageOffset
@@ -202,6 +248,28 @@ type (
 		Body   []byte
 	}
 
+	// ImageFormat identifies the host file format a disk image is
+	// stored in. See the FORMAT_* constants.
+	ImageFormat int
+
+	// Container describes how a DiskImage is stored in a host file.
+	// DiskImage itself is always held in MGT geometry; LoadContainer
+	// reports the original format so that SaveContainer can write
+	// the image back in the same form.
+	Container struct {
+		Format ImageFormat
+		// Compression is the compression the image file was wrapped
+		// in, if any. SaveContainer re-compresses the same way.
+		Compression Compression
+		// ZipEntry is the name of the disk image's member within a
+		// zip archive (Compression == COMPRESSION_ZIP only).
+		ZipEntry string
+	}
+
+	// Compression identifies a compression wrapper around a disk
+	// image file. See the COMPRESSION_* constants.
+	Compression int
+
 	// Sector identifies a (Track, Sector) location on disk.
 	// Track uses SAMDOS's side-encoding (bit 7 = side bit): values
 	// 0–79 are side 0, values 128–207 are side 1; values 80–127
@@ -219,8 +287,8 @@ type (
 // 0x00 of a directory entry (and byte 0 of the file body). FT_ERASED
 // (0) is the "free slot" sentinel; the others are the public SAM
 // types defined by the Tech Manual. Bit 7 of the byte marks the file
-// HIDDEN and bit 6 marks it PROTECTED — mask them off before comparing
-// against these constants.
+// HIDDEN and bit 6 marks it PROTECTED — FileEntry.Type has them
+// masked off, so it can be compared directly against these constants.
 const (
 	FT_ERASED      = FileType(0)  // slot is unused
 	FT_ZX_SNAPSHOT = FileType(5)  // 48K ZX Spectrum snapshot (SAMDOS extension)
@@ -231,6 +299,77 @@ const (
 	FT_SCREEN      = FileType(20) // SCREEN$ — display memory dump; mode stored at FileTypeInfo[0]
 )
 
+// Host file formats for disk images.
+const (
+	FORMAT_MGT  = ImageFormat(iota) // raw 819200-byte MGT image
+	FORMAT_EDSK                     // Extended CPC DSK image
+	FORMAT_SAD                      // SimCoupé SAD image
+)
+
+// String returns the format's conventional name ("MGT", "EDSK",
+// "SAD").
+func (format ImageFormat) String() string {
+	switch format {
+	case FORMAT_MGT:
+		return "MGT"
+	case FORMAT_EDSK:
+		return "EDSK"
+	case FORMAT_SAD:
+		return "SAD"
+	default:
+		return fmt.Sprintf("UNKNOWN (%v)", int(format))
+	}
+}
+
+// Compression wrappers for disk image files.
+const (
+	COMPRESSION_NONE = Compression(iota) // not compressed
+	COMPRESSION_GZIP                     // gzip stream (e.g. .mgt.gz)
+	COMPRESSION_ZIP                      // member of a zip archive
+)
+
+// String returns the compression's conventional name ("none", "gzip",
+// "zip").
+func (compression Compression) String() string {
+	switch compression {
+	case COMPRESSION_NONE:
+		return "none"
+	case COMPRESSION_GZIP:
+		return "gzip"
+	case COMPRESSION_ZIP:
+		return "zip"
+	default:
+		return fmt.Sprintf("UNKNOWN (%v)", int(compression))
+	}
+}
+
+// SAMDOS file attributes — the top two bits of the status / file-type
+// byte of a directory entry. HIDDEN files are omitted from SAMDOS DIR
+// listings; PROTECTED files cannot be erased or overwritten by SAMDOS.
+const (
+	FA_HIDDEN    = FileAttributes(0x80)
+	FA_PROTECTED = FileAttributes(0x40)
+
+	faMask = FA_HIDDEN | FA_PROTECTED
+)
+
+// String returns the set attributes as a comma-separated list
+// ("HIDDEN", "PROTECTED" or "HIDDEN, PROTECTED"), or "-" if none are
+// set.
+func (fa FileAttributes) String() string {
+	names := []string{}
+	if fa&FA_HIDDEN != 0 {
+		names = append(names, "HIDDEN")
+	}
+	if fa&FA_PROTECTED != 0 {
+		names = append(names, "PROTECTED")
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ", ")
+}
+
 // Output prints a debug summary of file to stdout: type, start address,
 // body length, and the raw body bytes.
 func (file *File) Output() {
@@ -352,29 +491,109 @@ func (sector *Sector) String() string {
 // Reference: https://www.cpcwiki.eu/index.php/Format:DSK_disk_image_file_format
 var edskMagic = []byte("EXTENDED CPC DSK File")
 
-// Load reads filename as a raw MGT disk image. Files smaller than
-// 819200 bytes are zero-padded on the right; files larger than that
-// are truncated. Extended CPC DSK images ("EDSK" — magic bytes
-// "EXTENDED CPC DSK File") are detected and rejected with a message
-// pointing at samdisk, which can convert them to MGT.
+// Load reads filename as a SAM disk image, converting it to MGT
+// geometry if it is stored in another container format (see
+// LoadContainer). Raw MGT files smaller than 819200 bytes are
+// zero-padded on the right; files larger than that are truncated.
 func Load(filename string) (*DiskImage, error) {
-	image, err := os.ReadFile(filename)
+	di, _, err := LoadContainer(filename)
+	return di, err
+}
+
+// LoadContainer reads filename as a SAM disk image and also returns a
+// Container describing the host file format it was stored in, so that
+// SaveContainer can write it back the same way. Extended CPC DSK
+// images (magic bytes "EXTENDED CPC DSK File") are converted with
+// DiskImageFromEDSK and SimCoupé SAD images (magic bytes "Aley's disk
+// backup") with DiskImageFromSAD; anything else is treated as raw MGT.
+//
+// Images may also be gzip-compressed (e.g. .mgt.gz, .sad.gz) or stored
+// in a zip archive. A zip archive must contain a single disk image,
+// unless the member to load is chosen with the filename syntax
+// "ARCHIVE.zip:NAME.mgt".
+func LoadContainer(filename string) (*DiskImage, *Container, error) {
+	archive, entry := splitArchivePath(filename)
+	image, err := os.ReadFile(archive)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error: can't load disk image %q: %v", filename, err)
+	}
+	di, container, err := decodeCompressed(image, entry)
 	if err != nil {
-		return nil, fmt.Errorf("error: can't load disk image %q: %v", filename, err)
+		return nil, nil, fmt.Errorf("error: can't load disk image %q: %v", filename, err)
 	}
-	if len(image) >= len(edskMagic) && bytes.Equal(image[:len(edskMagic)], edskMagic) {
-		return nil, fmt.Errorf("error: EDSK format not supported; convert to MGT with samdisk (https://simonowen.com/samdisk/): samdisk %s OUTPUT.mgt", filename)
+	return di, container, nil
+}
+
+// decodeImage detects the container format of image and converts it
+// to a DiskImage.
+func decodeImage(image []byte) (*DiskImage, *Container, error) {
+	if bytes.HasPrefix(image, edskMagic) {
+		di, err := DiskImageFromEDSK(image)
+		if err != nil {
+			return nil, nil, err
+		}
+		return di, &Container{Format: FORMAT_EDSK}, nil
+	}
+	if len(image) >= len(sadMagic) && bytes.EqualFold(image[:len(sadMagic)], sadMagic) {
+		di, err := DiskImageFromSAD(image)
+		if err != nil {
+			return nil, nil, err
+		}
+		return di, &Container{Format: FORMAT_SAD}, nil
 	}
 	d := DiskImage{}
 	copy(d[:], image)
-	return &d, nil
+	return &d, &Container{Format: FORMAT_MGT}, nil
 }
 
 // Save writes the whole 819200-byte image to filename, with mode 0600
-// (read-only for the owner). The destination is overwritten if it
-// already exists.
+// (read-only for the owner), in the host file format filename's
+// extension calls for (see ContainerFor): raw MGT unless it names an
+// EDSK, SAD, gzip or zip file. So Load("x.sad") followed by
+// Save("x.sad") writes a SAD file again. The destination is
+// overwritten if it already exists. To write the image back exactly as
+// it was loaded, whatever the file is called, use LoadContainer and
+// SaveContainer.
 func (di *DiskImage) Save(filename string) error {
-	err := os.WriteFile(filename, di[:], 0600)
+	return di.SaveContainer(filename, ContainerFor(filename))
+}
+
+// SaveContainer writes the image to filename in the host file format
+// described by container (typically the one returned by
+// LoadContainer), with mode 0600. The destination is overwritten if it
+// already exists.
+//
+// Gzip-compressed images are re-compressed. For zip archives, filename
+// is the archive (optionally with the ":NAME" suffix accepted by
+// LoadContainer): the image replaces member container.ZipEntry and all
+// other members are preserved.
+func (di *DiskImage) SaveContainer(filename string, container *Container) error {
+	var data []byte
+	switch container.Format {
+	case FORMAT_MGT:
+		data = di[:]
+	case FORMAT_EDSK:
+		data = di.EDSK()
+	case FORMAT_SAD:
+		data = di.SAD()
+	default:
+		return fmt.Errorf("error: can't write disk image %q: unsupported image format %v", filename, container.Format)
+	}
+	var err error
+	switch container.Compression {
+	case COMPRESSION_NONE:
+		err = os.WriteFile(filename, data, 0600)
+	case COMPRESSION_GZIP:
+		data, err = gzipBytes(data)
+		if err == nil {
+			err = os.WriteFile(filename, data, 0600)
+		}
+	case COMPRESSION_ZIP:
+		archive := strings.TrimSuffix(filename, ":"+container.ZipEntry)
+		err = writeZipEntry(archive, container.ZipEntry, data)
+	default:
+		err = fmt.Errorf("unsupported compression %v", container.Compression)
+	}
 	if err != nil {
 		return fmt.Errorf("error: can't write disk image %q: %v", filename, err)
 	}
@@ -447,7 +666,7 @@ func (i *DiskImage) DiskJournal() *DiskJournal {
 // FileEntryFrom parses the 256 bytes of a single SAMDOS directory
 // slot into a FileEntry. The on-disk byte map is:
 //
-//	0x00      Type / status byte
+//	0x00      Type / status byte (bits 7–6: Attributes)
 //	0x01–0x0A Filename (10 bytes, space-padded)
 //	0x0B–0x0C Sector count (big-endian!)
 //	0x0D–0x0E First-sector track and sector
@@ -467,8 +686,9 @@ func (i *DiskImage) DiskJournal() *DiskJournal {
 // Inverse of FileEntry.Raw.
 func FileEntryFrom(data [0x100]byte) *FileEntry {
 	fe := FileEntry{
-		Type:    FileType(data[0x00]),
-		Sectors: uint16(data[0x0b])<<8 | uint16(data[0x0c]), // big endian!
+		Type:       FileType(data[0x00]) & FileType(^faMask),
+		Attributes: FileAttributes(data[0x00]) & faMask,
+		Sectors:    uint16(data[0x0b])<<8 | uint16(data[0x0c]), // big endian!
 		FirstSector: &Sector{
 			Track:  data[0x0d],
 			Sector: data[0x0e],
@@ -497,7 +717,7 @@ func FileEntryFrom(data [0x100]byte) *FileEntry {
 // entry. Inverse of FileEntryFrom.
 func (fe *FileEntry) Raw() [0x100]byte {
 	raw := [0x100]byte{}
-	raw[0x00] = byte(fe.Type)
+	raw[0x00] = byte(fe.Type) | byte(fe.Attributes&faMask)
 	// raw[1]..raw[10]
 	for i := 0; i < 0x0a; i++ {
 		raw[i+1] = fe.Name[i]
@@ -556,10 +776,15 @@ func (dj *DiskJournal) Output() {
 // a set bit means "some file owns this sector", a clear bit means
 // "this sector is free". SAMDOS doesn't persist this bitmap on disk;
 // it reconstructs it on demand at allocation time, and so does
-// samfile (see AddCodeFile).
+// samfile (see AddCodeFile). Erased slots (Type == 0) are skipped:
+// SAMDOS ERASE only zeroes the Type byte and leaves the stale map
+// behind, and those sectors are free for reuse.
 func (dj *DiskJournal) CombinedSectorMap() *SectorAddressMap {
 	sam := new(SectorAddressMap)
 	for _, fe := range dj {
+		if fe.Type == FT_ERASED {
+			continue
+		}
 		sam.Merge(fe.SectorAddressMap)
 	}
 	return sam
@@ -581,18 +806,35 @@ func (dj *DiskJournal) UsedFileEntries() []int {
 	return dj.filterFileEntries(true)
 }
 
+// Match returns the slot indices (0–79) of the occupied entries whose
+// names match pattern (see Filename.Matches), in slot order. A pattern
+// without wildcards selects files by case-insensitive name.
+func (dj *DiskJournal) Match(pattern string) []int {
+	entries := []int{}
+	for _, i := range dj.UsedFileEntries() {
+		if dj[i].Name.Matches(pattern) {
+			entries = append(entries, i)
+		}
+	}
+	return entries
+}
+
 // FreeFileEntries returns the slot indices (0–79) that are available
 // for new files. AddCodeFile populates the lowest free slot.
 func (dj *DiskJournal) FreeFileEntries() []int {
 	return dj.filterFileEntries(false)
 }
 
-// Used reports whether the directory slot is occupied. SAMDOS itself
+// Used reports whether the directory slot is occupied. HIDDEN and
+// PROTECTED files count as occupied. SAMDOS itself
 // only treats slots with Type == 0 as erased; samfile additionally
 // rejects slots whose Type byte is not one of the documented FT_*
 // values or whose FirstSector.Track is 0 (the directory tracks, which
 // can never be a file's first sector).
 func (fe *FileEntry) Used() bool {
+	if fe.Type == FT_ERASED {
+		return false
+	}
 	if strings.HasPrefix(fe.Type.String(), "UNKNOWN") {
 		return false
 	}
@@ -619,19 +861,26 @@ func (fe *FileEntry) Output() error {
 	if fe.Type == FT_ERASED {
 		return nil
 	}
+	if fe.Attributes != 0 {
+		fmt.Printf("  Attributes:                        %v\n", fe.Attributes)
+	}
 	switch fe.Type {
-	case FT_NUM_ARRAY:
-		fmt.Printf("  Number Array Info:                 %v\n", fe.FileTypeInfo)
-	case FT_STR_ARRAY:
-		fmt.Printf("  String Array Info:                 %v\n", fe.FileTypeInfo)
+	case FT_NUM_ARRAY, FT_STR_ARRAY:
+		fmt.Printf("  Array Name:                        %v\n", fe.ArrayName())
 	case FT_SCREEN:
-		fmt.Printf("  Screen Mode:                       %v\n", fe.FileTypeInfo[0])
+		fmt.Printf("  Screen Mode:                       %v\n", fe.ScreenMode())
 	case FT_SAM_BASIC:
 		fmt.Printf("  Program length:                    %v\n", fe.ProgramLength())
 		fmt.Printf("  Numeric variables size:            %v\n", fe.NumericVariablesSize())
 		fmt.Printf("  Gap size:                          %v\n", fe.GapSize())
 		fmt.Printf("  String/array variables size:       %v\n", fe.StringArrayVariablesSize())
 	}
+	if fe.Type == FT_ZX_SNAPSHOT {
+		// The directory holds registers rather than a start and
+		// length (see Snapshot).
+		fmt.Printf("  Length:                            %v\n", SnapshotLength)
+		return nil
+	}
 	fmt.Printf("  Start:                             %v\n", fe.StartAddress())
 	fmt.Printf("  Length:                            %v\n", fe.Length())
 	switch fe.Type {
@@ -645,6 +894,16 @@ func (fe *FileEntry) Output() error {
 	return nil
 }
 
+// Hidden reports whether the HIDDEN attribute bit is set.
+func (fe *FileEntry) Hidden() bool {
+	return fe.Attributes&FA_HIDDEN != 0
+}
+
+// Protected reports whether the PROTECTED attribute bit is set.
+func (fe *FileEntry) Protected() bool {
+	return fe.Attributes&FA_PROTECTED != 0
+}
+
 // pageFormLength decodes a 19-bit length stored in SAM Coupé "PAGEFORM":
 // byte 0 is a page count (16384 bytes per page); bytes 1-2 are a
 // little-endian 16-bit address in section C (0x8000-0xBFFF) whose low
@@ -721,51 +980,71 @@ func (fe *FileEntry) Length() uint32 {
 }
 
 // File reads the named file out of the disk image, walking its
-// sector chain from FirstSector and assembling the body. The match
-// against filename is exact against the trimmed Filename.String() of
-// each occupied directory entry — there is no wildcard or
-// case-folding. The returned File.Header is reconstructed from the
-// first 9 bytes of the body; File.Body is the remainder.
+// sector chain from FirstSector and assembling the body. filename is
+// compared against the trimmed Filename.String() of each occupied
+// directory entry case-insensitively, as SAMDOS does (erased slots are
+// ignored); wildcards are not expanded — use DiskJournal.Match and
+// ReadFile for that. The returned File.Header is reconstructed from
+// the first 9 bytes of the body; File.Body is the remainder. An
+// FT_ZX_SNAPSHOT file has no header (see ReadSnapshot): its File.Body
+// is the SnapshotLength bytes of RAM, and its File.Header has only
+// Type and the length set.
 func (di *DiskImage) File(filename string) (*File, error) {
+	dj := di.DiskJournal()
+	slot, err := dj.findFileEntry(filename)
+	if err != nil {
+		return nil, err
+	}
+	return di.ReadFile(dj[slot])
+}
 
-	for _, fe := range di.DiskJournal() {
-		if fe.Name.String() == filename {
-			fileLength := fe.Length()
-			raw := make([]byte, fileLength+9)
-			sectorData, err := di.SectorData(fe.FirstSector)
-			if err != nil {
-				return nil, err
-			}
-			filepart := sectorData.FilePart()
-			i := uint16(0)
-			for {
-				copy(raw[510*i:], filepart.Data[:])
-				i++
-				if i == fe.Sectors {
-					break
-				}
-				sectorData, err = di.SectorData(filepart.NextSector)
-				if err != nil {
-					return nil, err
-				}
-				filepart = sectorData.FilePart()
-			}
-			file := &File{
-				Header: &FileHeader{
-					Type:                     FileType(raw[0]),
-					LengthMod16K:             uint16(raw[1]) | uint16(raw[2])<<8,
-					PageOffset:               uint16(raw[3]) | uint16(raw[4])<<8,
-					ExecutionAddressDiv16K:   raw[5],
-					ExecutionAddressMod16KLo: raw[6],
-					Pages:                    raw[7],
-					StartPage:                raw[8] & 0x1f,
-				},
-				Body: raw[9:],
-			}
-			return file, nil
+// ReadFile reads the file described by directory entry fe out of the
+// disk image, following its sector chain from FirstSector. See File.
+// Returns an error if Sectors doesn't match the number of sectors the
+// file's length needs, or if the sector chain is broken, shorter or
+// longer than that.
+func (di *DiskImage) ReadFile(fe *FileEntry) (*File, error) {
+	headerLength, bodyLength := 9, int(fe.Length())
+	if fe.Type == FT_ZX_SNAPSHOT {
+		headerLength, bodyLength = 0, SnapshotLength
+	}
+	raw := make([]byte, headerLength+bodyLength)
+	required := (len(raw) + 509) / 510
+	if int(fe.Sectors) != required {
+		return nil, fmt.Errorf("file %q is %v bytes long, which needs %v sectors, but its directory entry has %v", fe.Name.String(), len(raw), required, fe.Sectors)
+	}
+	chain, kind, description := di.sectorChain(fe.FirstSector)
+	switch {
+	case len(chain) < required && kind != "":
+		return nil, fmt.Errorf("file %q has a broken sector chain (%v: %v)", fe.Name.String(), kind, description)
+	case len(chain) != required:
+		return nil, fmt.Errorf("file %q has a sector chain of %v sectors but should have %v", fe.Name.String(), len(chain), required)
+	}
+	for i, sector := range chain {
+		sectorData, err := di.SectorData(sector)
+		if err != nil {
+			return nil, err
 		}
+		copy(raw[i*510:], sectorData.FilePart().Data[:])
+	}
+	if fe.Type == FT_ZX_SNAPSHOT {
+		header := &FileHeader{Type: FT_ZX_SNAPSHOT}
+		header.Pages, header.LengthMod16K = uint8(SnapshotLength>>14), SnapshotLength&0x3fff
+		return &File{Header: header, Body: raw}, nil
 	}
-	return nil, fmt.Errorf("file %v not found", filename)
+	file := &File{
+		Header: &FileHeader{
+			Type:                     FileType(raw[0]),
+			LengthMod16K:             uint16(raw[1]) | uint16(raw[2])<<8,
+			PageOffset:               uint16(raw[3]) | uint16(raw[4])<<8,
+			ExecutionAddressDiv16K:   raw[5],
+			ExecutionAddressMod16KLo: raw[6],
+			Pages:                    raw[7],
+			StartPage:                raw[8] & 0x1f,
+		},
+		Body: raw[9:],
+	}
+	return file, nil
 }
 
 // String returns filename with any trailing NULs and spaces removed,
@@ -781,6 +1060,50 @@ func (filename Filename) String() string {
 	return strings.TrimRight(string(b), " ")
 }
 
+// EqualFold reports whether filename is name, ignoring trailing spaces
+// and the case of ASCII letters — the comparison SAMDOS uses when
+// looking a file up by name.
+func (filename Filename) EqualFold(name string) bool {
+	return strings.EqualFold(filename.String(), strings.TrimRight(name, " "))
+}
+
+// Matches reports whether filename matches pattern using SAMDOS
+// DIR / LOAD wildcard rules: `*` matches any run of characters
+// (including none), `?` matches exactly one character, and all other
+// characters match themselves, ignoring the case of ASCII letters.
+// Trailing spaces are ignored on both sides.
+func (filename Filename) Matches(pattern string) bool {
+	return wildcardMatch(strings.ToUpper(strings.TrimRight(pattern, " ")), strings.ToUpper(filename.String()))
+}
+
+// wildcardMatch reports whether name matches pattern, where `*` in
+// pattern matches any run of bytes and `?` matches any single byte.
+func wildcardMatch(pattern, name string) bool {
+	p, n := 0, 0
+	// Position of the most recent `*` in pattern, and the position in
+	// name it was tried against, for backtracking.
+	star, starName := -1, 0
+	for n < len(name) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == name[n]):
+			p++
+			n++
+		case p < len(pattern) && pattern[p] == '*':
+			star, starName = p, n
+			p++
+		case star >= 0:
+			starName++
+			p, n = star+1, starName
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
 // AddCodeFile writes data to the disk image as a new SAMDOS type-19
 // (CODE) file named name, allocating a free directory slot and the
 // required free sectors. loadAddress is the SAM address the file
@@ -790,9 +1113,10 @@ func (filename Filename) String() string {
 // value is the address the loader will JP to after loading and must
 // lie within the loaded region.
 //
-// Returns an error if the address validations fail, if the disk has
-// no free directory slots (max 80 files), or if there are not enough
-// free sectors to hold the data plus the 9-byte file header.
+// Returns an error if name is empty or longer than 10 bytes, if the
+// address validations fail, if the disk has no free directory slots
+// (max 80 files), or if there are not enough free sectors to hold the
+// data plus the 9-byte file header.
 func (di *DiskImage) AddCodeFile(name string, data []byte, loadAddress, executionAddress uint32) error {
 	if loadAddress < 1<<14 {
 		return fmt.Errorf("load address %v of %q is in ROM but must be %v of higher to be loaded into RAM", loadAddress, name, 1<<14)
@@ -855,18 +1179,17 @@ func (di *DiskImage) SetStartAddressPageUnusedBits(name string, bits uint8) erro
 		return fmt.Errorf("StartAddressPage unused bits value %d out of range (0..7)", bits)
 	}
 	dj := di.DiskJournal()
-	for slot, fe := range dj {
-		if !fe.Used() || fe.Name.String() != name {
-			continue
-		}
-		value := (fe.StartAddressPage & 0x1F) | (bits << 5)
-		fe.StartAddressPage = value
-		fe.MGTFutureAndPast[9] = value
-		di.WriteFileEntry(dj, slot)
-		di[fe.FirstSector.Offset()+8] = value
-		return nil
+	slot, err := dj.findFileEntry(name)
+	if err != nil {
+		return err
 	}
-	return fmt.Errorf("file %v not found", name)
+	fe := dj[slot]
+	value := (fe.StartAddressPage & 0x1F) | (bits << 5)
+	fe.StartAddressPage = value
+	fe.MGTFutureAndPast[9] = value
+	di.WriteFileEntry(dj, slot)
+	di[fe.FirstSector.Offset()+8] = value
+	return nil
 }
 
 func pageForm3Byte(value uint32) [3]byte {
@@ -972,28 +1295,12 @@ func (fe *FileEntry) CreateHeader() *FileHeader {
 }
 
 func (di *DiskImage) addFile(name string, fe *FileEntry, data []byte) error {
-	dj := di.DiskJournal()
-	freeFileEntries := dj.FreeFileEntries()
-	if len(freeFileEntries) < 1 {
-		return fmt.Errorf("cannot add file %q to disk; disk already contains maximum number of files (80).", name)
-	}
-	requiredSectorCount := (len(data) + 9 + 509) / 510
-	freeSectors := dj.CombinedSectorMap().FreeSectors()
-	if len(freeSectors) < requiredSectorCount {
-		return fmt.Errorf("cannot add file %q to disk; not enough space (%v free sectors required but only %v sectors available).", name, requiredSectorCount, len(freeSectors))
-	}
-	fe.Name = *(*[10]byte)([]byte(name + "          "))
-	fe.Sectors = uint16(requiredSectorCount)
-	fe.FirstSector = freeSectors[0]
 	fe.Pages = uint8(len(data) >> 14)
 	fe.LengthMod16K = uint16(len(data) & 0x3fff)
-	fe.SectorAddressMap = &SectorAddressMap{}
-
 	f := &File{
 		Header: fe.CreateHeader(),
 		Body:   data,
 	}
-	raw := f.Raw()
 
 	// Mirror the 9-byte body header into MGTFutureAndPast[1..9] so
 	// the directory entry's MGT "future and past" region matches the
@@ -1005,6 +1312,42 @@ func (di *DiskImage) addFile(name string, fe *FileEntry, data []byte) error {
 	// real disks saved by ROM SAVE populate this region.
 	header := f.Header.Raw()
 	copy(fe.MGTFutureAndPast[1:10], header[:])
+	return di.addRawFile(name, fe, f.Raw())
+}
+
+// addRawFile writes raw, the complete contents of a file (normally a
+// 9-byte FileHeader followed by the body), to the first free
+// directory slot and the first free sectors, filling in fe's name,
+// sector count, first sector and sector address map. name must be a
+// valid SAMDOS filename (see FilenameFrom).
+//
+// Slot 0's MGTFutureAndPast bytes hold the disk label on a labelled
+// disk (see Label), so there the label is kept in place of whatever
+// fe carries.
+func (di *DiskImage) addRawFile(name string, fe *FileEntry, raw []byte) error {
+	filename, err := FilenameFrom(name)
+	if err != nil {
+		return fmt.Errorf("cannot add file %q to disk: %w", name, err)
+	}
+	dj := di.DiskJournal()
+	freeFileEntries := dj.FreeFileEntries()
+	if len(freeFileEntries) < 1 {
+		return fmt.Errorf("cannot add file %q to disk; disk already contains maximum number of files (80).", name)
+	}
+	requiredSectorCount := (len(raw) + 509) / 510
+	freeSectors := dj.CombinedSectorMap().FreeSectors()
+	if len(freeSectors) < requiredSectorCount {
+		return fmt.Errorf("cannot add file %q to disk; not enough space (%v free sectors required but only %v sectors available).", name, requiredSectorCount, len(freeSectors))
+	}
+	fe.Name = filename
+	fe.Sectors = uint16(requiredSectorCount)
+	fe.FirstSector = freeSectors[0]
+	fe.SectorAddressMap = &SectorAddressMap{}
+
+	slot := freeFileEntries[0]
+	if slot == 0 && di.Label() != "" {
+		copy(fe.MGTFutureAndPast[:], di[labelOffset:labelOffset+10])
+	}
 
 	sd := &SectorData{}
 	for i := 0; i < requiredSectorCount; i++ {
@@ -1020,8 +1363,161 @@ func (di *DiskImage) addFile(name string, fe *FileEntry, data []byte) error {
 		fe.SectorAddressMap[offset] |= byte(mask)
 		di.WriteSector(freeSectors[i], sd)
 	}
-	dj[freeFileEntries[0]] = fe
-	di.WriteFileEntry(dj, freeFileEntries[0])
+	dj[slot] = fe
+	di.WriteFileEntry(dj, slot)
+	return nil
+}
+
+// Find returns the slot of the named file, comparing name against the
+// trimmed name of each used directory entry case-insensitively, as
+// SAMDOS does (see File). Returns an error if no used slot matches.
+func (dj *DiskJournal) Find(name string) (int, error) {
+	return dj.findFileEntry(name)
+}
+
+// findFileEntry returns the slot index of the first occupied directory
+// entry named name (compared case-insensitively, see
+// Filename.EqualFold), or an error if there is none.
+func (dj *DiskJournal) findFileEntry(name string) (int, error) {
+	for slot, fe := range dj {
+		if fe.Used() && fe.Name.EqualFold(name) {
+			return slot, nil
+		}
+	}
+	return -1, fmt.Errorf("file %v not found", name)
+}
+
+// DeleteFile erases the named file the way SAMDOS ERASE does: the
+// directory slot's whole status byte (Type and Attributes) is set to
+// 0 and everything else in the slot (name, sector map, etc.) is left
+// untouched. The slot and the file's sectors become available to
+// subsequent AddCodeFile / AddBasicFile calls, since
+// CombinedSectorMap ignores erased slots.
+//
+// If scrub is true, every sector recorded in the file's
+// SectorAddressMap is additionally overwritten with zeros, so that the
+// file body cannot be recovered from the image.
+//
+// Returns an error if the file is not present on disk, or if it is
+// PROTECTED (SAMDOS refuses to erase protected files too; clear the
+// attribute with SetFileAttributes first).
+func (di *DiskImage) DeleteFile(name string, scrub bool) error {
+	dj := di.DiskJournal()
+	slot, err := dj.findFileEntry(name)
+	if err != nil {
+		return err
+	}
+	fe := dj[slot]
+	if fe.Protected() {
+		return fmt.Errorf("file %v is PROTECTED", name)
+	}
+	if scrub {
+		for _, sector := range fe.SectorAddressMap.UsedSectors() {
+			di.WriteSector(sector, &SectorData{})
+		}
+	}
+	fe.Type = FT_ERASED
+	fe.Attributes = 0
+	di.WriteFileEntry(dj, slot)
+	return nil
+}
+
+// SetFileAttributes replaces the HIDDEN / PROTECTED attribute bits of
+// the named file with attributes. Only the top two bits of the
+// directory entry's status byte are changed. Returns an error if
+// attributes contains bits other than FA_HIDDEN and FA_PROTECTED, or
+// if the file is not present on disk.
+func (di *DiskImage) SetFileAttributes(name string, attributes FileAttributes) error {
+	if attributes&^faMask != 0 {
+		return fmt.Errorf("invalid file attributes 0x%02x (only HIDDEN 0x80 and PROTECTED 0x40 are supported)", uint8(attributes))
+	}
+	dj := di.DiskJournal()
+	slot, err := dj.findFileEntry(name)
+	if err != nil {
+		return err
+	}
+	dj[slot].Attributes = attributes
+	di.WriteFileEntry(dj, slot)
+	return nil
+}
+
+// FilenameFrom returns name as a space-padded Filename. Returns an
+// error if name is empty or longer than the 10 bytes available in a
+// directory entry.
+func FilenameFrom(name string) (Filename, error) {
+	filename := Filename{}
+	if len(name) == 0 {
+		return filename, fmt.Errorf("filename must not be empty")
+	}
+	if len(name) > len(filename) {
+		return filename, fmt.Errorf("filename %q is %v bytes long but SAMDOS filenames are limited to %v bytes", name, len(name), len(filename))
+	}
+	copy(filename[:], name+"          ")
+	return filename, nil
+}
+
+// RenameFile changes the name of file oldName to newName. Only the
+// Name field of the directory entry is rewritten: the slot, sector
+// chain and file body are left exactly where they are. Returns an
+// error if oldName is not present on disk, if newName is not a valid
+// filename (see FilenameFrom), or if another file called newName
+// already exists (compared case-insensitively, as SAMDOS does).
+func (di *DiskImage) RenameFile(oldName, newName string) error {
+	filename, err := FilenameFrom(newName)
+	if err != nil {
+		return err
+	}
+	dj := di.DiskJournal()
+	slot, err := dj.findFileEntry(oldName)
+	if err != nil {
+		return err
+	}
+	if existing, err := dj.findFileEntry(filename.String()); err == nil && existing != slot {
+		return fmt.Errorf("cannot rename %q to %q: file %q already exists", oldName, newName, filename.String())
+	}
+	dj[slot].Name = filename
+	di.WriteFileEntry(dj, slot)
+	return nil
+}
+
+// labelOffset is the image offset of the disk label: bytes 0xD2–0xDB
+// of directory slot 0.
+const labelOffset = 0xd2
+
+// Label returns the disk label, with trailing spaces removed, or "" if
+// the disk is unlabelled. MasterDOS keeps the label in the
+// MGTFutureAndPast bytes (0xD2–0xDB) of the first directory entry,
+// where SAMDOS would otherwise mirror that file's header; a first byte
+// of 0x00 or 0xFF means no label has been set.
+func (di *DiskImage) Label() string {
+	label := di[labelOffset : labelOffset+10]
+	if label[0] == 0x00 || label[0] == 0xff {
+		return ""
+	}
+	return strings.TrimRight(string(label), " ")
+}
+
+// SetLabel sets the disk label (see Label) to label, space padded to
+// 10 bytes, or clears it if label is "". Clearing the label of a disk
+// whose first slot holds a file restores that file's header mirror.
+// Returns an error if label is longer than 10 bytes or starts with a
+// space.
+func (di *DiskImage) SetLabel(label string) error {
+	if len(label) > 10 {
+		return fmt.Errorf("disk label %q is longer than 10 characters", label)
+	}
+	if strings.HasPrefix(label, " ") {
+		return fmt.Errorf("disk label %q must not start with a space", label)
+	}
+	raw := [10]byte{}
+	if label != "" {
+		copy(raw[:], label+"          ")
+	} else if fe := di.DiskJournal()[0]; fe.Used() {
+		if sd, err := di.SectorData(fe.FirstSector); err == nil {
+			copy(raw[1:10], sd[:9])
+		}
+	}
+	copy(di[labelOffset:], raw[:])
 	return nil
 }
 
@@ -1029,13 +1525,24 @@ func (di *DiskImage) addFile(name string, fe *FileEntry, data []byte) error {
 // directory slot index. Call this after mutating an entry to commit
 // the change to the disk image. No bounds checking on index.
 func (di *DiskImage) WriteFileEntry(dj *DiskJournal, index int) {
-	offset := index << 8
+	offset := DirectorySector(index).Offset() + (index&1)<<8
 	rawFileEntry := dj[index].Raw()
 	for i, b := range rawFileEntry {
 		di[i+offset] = b
 	}
 }
 
+// DirectorySector returns the location of the directory sector that
+// holds slot index (0–79): two slots per sector, ten sectors per
+// track, starting at (track 0, sector 1). Even slots occupy the first
+// 256 bytes of the sector, odd slots the second 256 bytes.
+func DirectorySector(index int) *Sector {
+	return &Sector{
+		Track:  uint8(index / 20),
+		Sector: uint8(index%20/2 + 1),
+	}
+}
+
 // SAMMask returns the (byte offset, bit mask) within a
 // 195-byte SectorAddressMap that corresponds to sector. The bit
 // position is computed as ((Track & 0x7f) × 10) + (Sector − 1) +
@@ -1043,7 +1550,7 @@ func (di *DiskImage) WriteFileEntry(dj *DiskJournal, index int) {
 // being outside the map's domain. Used by AddCodeFile to update the
 // per-file map.
 func (sector *Sector) SAMMask() (offset uint8, mask uint8) {
-	bitOffset := (int(sector.Track)&0x7f)*10 + int(sector.Sector) - 1 + ((int(sector.Track)&0x80)>>7)*800 - 40
+	bitOffset := sector.mapIndex()
 	return uint8(bitOffset >> 3), 1 << (bitOffset & 0x07)
 }
 
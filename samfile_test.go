@@ -0,0 +1,245 @@
+package samfile
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestDeleteFileFreesSlotAndSectors(t *testing.T) {
+	di := NewDiskImage()
+	data := bytes.Repeat([]byte{0xAA}, 2000)
+	if err := di.AddCodeFile("FIRST", data, 0x8000, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := di.AddCodeFile("SECOND", data, 0x8000, 0); err != nil {
+		t.Fatal(err)
+	}
+	before := len(di.DiskJournal().CombinedSectorMap().FreeSectors())
+	first := di.DiskJournal()[0].FirstSector
+
+	if err := di.DeleteFile("FIRST", false); err != nil {
+		t.Fatal(err)
+	}
+	dj := di.DiskJournal()
+	if dj[0].Used() {
+		t.Fatalf("slot 0 still in use after DeleteFile")
+	}
+	if dj[0].Name.String() != "FIRST" {
+		t.Errorf("DeleteFile should only clear the Type byte, but name is now %q", dj[0].Name)
+	}
+	if after := len(dj.CombinedSectorMap().FreeSectors()); after != before+4 {
+		t.Errorf("expected %v free sectors after delete, got %v", before+4, after)
+	}
+	if _, err := di.File("FIRST"); err == nil {
+		t.Errorf("deleted file is still readable")
+	}
+	if sd, _ := di.SectorData(first); sd[100] != 0xAA {
+		t.Errorf("sector contents should be left intact without scrub")
+	}
+
+	first = dj[1].FirstSector
+	if err := di.DeleteFile("SECOND", true); err != nil {
+		t.Fatal(err)
+	}
+	if sd, _ := di.SectorData(first); *sd != (SectorData{}) {
+		t.Errorf("sector contents not scrubbed")
+	}
+	if err := di.DeleteFile("SECOND", false); err == nil {
+		t.Errorf("expected error deleting a file that no longer exists")
+	}
+}
+
+func TestRenameFile(t *testing.T) {
+	di := NewDiskImage()
+	for _, name := range []string{"ALPHA", "BETA"} {
+		if err := di.AddCodeFile(name, []byte{1, 2, 3}, 0x8000, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := di.DiskJournal()[0]
+	if err := di.RenameFile("ALPHA", "ENOLA_G .M"); err != nil {
+		t.Fatal(err)
+	}
+	after := di.DiskJournal()[0]
+	if after.Name.String() != "ENOLA_G .M" {
+		t.Errorf("expected slot 0 to be renamed, but it is called %q", after.Name)
+	}
+	after.Name = before.Name
+	if after.Raw() != before.Raw() {
+		t.Errorf("RenameFile changed more than the Name field")
+	}
+	for _, tc := range []struct{ from, to string }{
+		{"ENOLA_G .M", "BETA"},
+		{"ENOLA_G .M", "ELEVENCHARS"},
+		{"ENOLA_G .M", ""},
+		{"MISSING", "GAMMA"},
+	} {
+		if err := di.RenameFile(tc.from, tc.to); err == nil {
+			t.Errorf("expected error renaming %q to %q", tc.from, tc.to)
+		}
+	}
+}
+
+func TestFileAttributes(t *testing.T) {
+	di := NewDiskImage()
+	if err := di.AddCodeFile("SECRET", []byte{1, 2, 3}, 0x8000, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := di.SetFileAttributes("SECRET", FA_HIDDEN|FA_PROTECTED); err != nil {
+		t.Fatal(err)
+	}
+	if di[0] != byte(FT_CODE)|0xC0 {
+		t.Fatalf("expected status byte 0x%02x, got 0x%02x", byte(FT_CODE)|0xC0, di[0])
+	}
+	fe := di.DiskJournal()[0]
+	if !fe.Used() || fe.Type != FT_CODE || !fe.Hidden() || !fe.Protected() {
+		t.Fatalf("hidden/protected file parsed incorrectly: used=%v type=%v attributes=%v", fe.Used(), fe.Type, fe.Attributes)
+	}
+	if f, err := di.File("SECRET"); err != nil || !bytes.Equal(f.Body, []byte{1, 2, 3}) {
+		t.Fatalf("could not read hidden file: %v", err)
+	}
+	if err := di.DeleteFile("SECRET", false); err == nil {
+		t.Errorf("expected error deleting a PROTECTED file")
+	}
+	if err := di.SetFileAttributes("SECRET", 0x01); err == nil {
+		t.Errorf("expected error for invalid attribute bits")
+	}
+	if err := di.SetFileAttributes("SECRET", 0); err != nil {
+		t.Fatal(err)
+	}
+	if di[0] != byte(FT_CODE) {
+		t.Errorf("expected attributes to be cleared, got status byte 0x%02x", di[0])
+	}
+}
+
+func TestWriteFileEntryAllSlots(t *testing.T) {
+	di := NewDiskImage()
+	dj := di.DiskJournal()
+	for slot := range dj {
+		dj[slot].Type = FT_CODE
+		dj[slot].Name, _ = FilenameFrom(fmt.Sprintf("SLOT%02d", slot))
+		di.WriteFileEntry(dj, slot)
+	}
+	for slot, fe := range di.DiskJournal() {
+		if want := fmt.Sprintf("SLOT%02d", slot); fe.Name.String() != want {
+			t.Errorf("slot %v: expected name %q, got %q", slot, want, fe.Name)
+		}
+	}
+}
+
+func TestFilenameMatches(t *testing.T) {
+	name, _ := FilenameFrom("ENOLA_G .M")
+	for pattern, want := range map[string]bool{
+		"ENOLA_G .M":  true,
+		"enola_g .m":  true,
+		"ENOLA_G .M ": true,
+		"ENOLA*":      true,
+		"*.m":         true,
+		"*":           true,
+		"E*A*.?":      true,
+		"ENOLA_G ?M":  true,
+		"?NOLA_G .M":  true,
+		"ENOLA":       false,
+		"*.S":         false,
+		"ENOLA_G .M?": false,
+		"":            false,
+	} {
+		if got := name.Matches(pattern); got != want {
+			t.Errorf("%q matches %q: expected %v, got %v", name, pattern, want, got)
+		}
+	}
+}
+
+func TestCaseInsensitiveLookup(t *testing.T) {
+	di := NewDiskImage()
+	for _, name := range []string{"LOADER", "GAME.1", "GAME.2"} {
+		if err := di.AddCodeFile(name, []byte(name), 0x8000, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := di.File("loader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(f.Body) != "LOADER" {
+		t.Errorf("wrong file returned for %q: %q", "loader", f.Body)
+	}
+	if slots := di.DiskJournal().Match("game.?"); len(slots) != 2 || slots[0] != 1 || slots[1] != 2 {
+		t.Errorf("expected slots [1 2] to match %q, got %v", "game.?", slots)
+	}
+	if err := di.RenameFile("GAME.1", "Loader"); err == nil {
+		t.Errorf("expected error renaming to a name that differs only in case from an existing file")
+	}
+}
+
+func TestReadFileLargerThan65K(t *testing.T) {
+	di := NewDiskImage()
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i * 7 / 3)
+	}
+	if err := di.AddCodeFile("BIG", data, 0x8000, 0); err != nil {
+		t.Fatal(err)
+	}
+	f, err := di.File("BIG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.Body, data) {
+		t.Errorf("body of 100000 byte file read back differently")
+	}
+}
+
+func TestReadFileBadChain(t *testing.T) {
+	di := NewDiskImage()
+	if err := di.AddCodeFile("CODE", make([]byte, 2000), 0x8000, 0); err != nil {
+		t.Fatal(err)
+	}
+	fe := di.DiskJournal()[0]
+	fe.Sectors--
+	if _, err := di.ReadFile(fe); err == nil {
+		t.Errorf("expected error reading a file with too few sectors for its length")
+	}
+	fe.Sectors++
+	fe.Pages = 3
+	if _, err := di.ReadFile(fe); err == nil {
+		t.Errorf("expected error reading a file longer than its sectors")
+	}
+	fe.Pages = 0
+	sd, _ := di.SectorData(fe.FirstSector)
+	sd[510], sd[511] = 0, 0
+	di.WriteSector(fe.FirstSector, sd)
+	if _, err := di.ReadFile(fe); err == nil {
+		t.Errorf("expected error reading a file whose sector chain ends early")
+	}
+}
+
+func TestDeleteHiddenFile(t *testing.T) {
+	di := NewDiskImage()
+	if err := di.AddCodeFile("HIDDEN", []byte{1, 2, 3}, 0x8000, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := di.SetFileAttributes("HIDDEN", FA_HIDDEN); err != nil {
+		t.Fatal(err)
+	}
+	if err := di.DeleteFile("HIDDEN", false); err != nil {
+		t.Fatal(err)
+	}
+	if di[0] != 0 {
+		t.Errorf("expected status byte 0x00 after deleting a hidden file, got 0x%02x", di[0])
+	}
+	if free := di.DiskJournal().FreeFileEntries(); len(free) != 80 {
+		t.Errorf("expected all 80 slots free, got %v", len(free))
+	}
+}
+
+func TestAddFileRejectsLongName(t *testing.T) {
+	di := NewDiskImage()
+	if err := di.AddCodeFile("longfilename.bin", []byte{1}, 0x8000, 0); err == nil {
+		t.Errorf("expected error adding a file whose name is longer than 10 bytes")
+	}
+	if free := di.DiskJournal().FreeFileEntries(); len(free) != 80 {
+		t.Errorf("expected all 80 slots free, got %v", len(free))
+	}
+}
@@ -0,0 +1,406 @@
+package samfile
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// SCREEN$ file bodies hold a dump of display memory followed by the
+// ROM's palette table and its line interrupt palette changes.
+//
+// Display memory is laid out per screen mode:
+//
+//   - MODE 1: the ZX Spectrum layout. 6144 bytes of 256×192 1-bit
+//     pixels in the Spectrum's interleaved line order, then 768
+//     attribute bytes, one per 8×8 cell.
+//   - MODE 2: 6144 bytes of 256×192 1-bit pixels, 32 bytes per line in
+//     line order, then (from offset 0x2000) 6144 attribute bytes, one
+//     per 8×1 cell.
+//   - MODE 3: 512×192 pixels, 2 bits per pixel (leftmost pixel in the
+//     top bits), 128 bytes per line.
+//   - MODE 4: 256×192 pixels, 4 bits per pixel (leftmost pixel in the
+//     high nibble), 128 bytes per line.
+//
+// Attribute bytes hold the ink in bits 0–2, the paper in bits 3–5, BRIGHT
+// in bit 6 (selecting pens 8–15 rather than 0–7) and FLASH in bit 7.
+//
+// The 40-byte palette table is two 20-byte halves, the second holding
+// the alternate colours used when flashing. Each half is the 16 pens
+// used in modes 1, 2 and 4 followed by the 4 pens used in mode 3; each
+// entry is a 7-bit SAM colour (see SAMColour). The line interrupt table
+// that follows has 4-byte entries terminated by 0xFF.
+const (
+	screenHeight          = 192
+	screenPaletteSize     = 40
+	screenMode3PensOffset = 16
+)
+
+var (
+	// screenSizes is the size of display memory in each screen mode
+	// (index 0 is unused).
+	screenSizes = [5]int{0, 6912, 0x2000 + 6144, 24576, 24576}
+
+	// defaultScreenPalette is the palette set by the ROM at power on,
+	// used if a SCREEN$ body is too short to hold a palette table.
+	defaultScreenPalette = [16]uint8{0, 17, 34, 51, 68, 85, 102, 119, 0, 25, 42, 59, 76, 93, 110, 127}
+)
+
+// SAMColour returns the RGB colour of c, an entry of the SAM's
+// 128-colour palette. Bits 0, 1 and 2 are the low bits of blue, red and
+// green, bits 4, 5 and 6 the high bits, and bit 3 (BRIGHT) adds half
+// an intensity step to all three, giving 8 levels per channel.
+func SAMColour(c uint8) color.RGBA {
+	bright := c >> 3 & 1
+	level := func(low, high uint8) uint8 {
+		l := (c>>high&1)<<2 | (c>>low&1)<<1 | bright
+		return uint8((uint(l)*255 + 3) / 7)
+	}
+	return color.RGBA{
+		R: level(1, 5),
+		G: level(2, 6),
+		B: level(0, 4),
+		A: 0xff,
+	}
+}
+
+// ScreenMode returns the screen mode (1–4) of an FT_SCREEN file. The
+// ROM records MODE − 1 (the mode bits of the VMPR port) in
+// FileTypeInfo[0].
+func (fe *FileEntry) ScreenMode() int {
+	return int(fe.FileTypeInfo[0]&0x03) + 1
+}
+
+// DecodeScreen decodes body, the body of an FT_SCREEN file saved in
+// screen mode mode (1–4, see FileEntry.ScreenMode), into an image
+// coloured by the palette stored after the display memory. Mode 3
+// images are 512×192 pixels, the others 256×192. FLASH attributes and
+// line interrupt palette changes are ignored: the image shows the
+// first palette, as at the start of each frame.
+//
+// Returns an error if mode is not 1–4 or body is too short to hold the
+// display memory of that mode.
+func DecodeScreen(body []byte, mode int) (*image.Paletted, error) {
+	if mode < 1 || mode > 4 {
+		return nil, fmt.Errorf("invalid screen mode %v (must be 1-4)", mode)
+	}
+	size := screenSizes[mode]
+	if len(body) < size {
+		return nil, fmt.Errorf("mode %v screen needs %v bytes of display memory but file is only %v bytes", mode, size, len(body))
+	}
+	pens := defaultScreenPalette[:]
+	if len(body) >= size+screenPaletteSize {
+		pens = body[size : size+16]
+	}
+	if mode == 3 {
+		if len(body) >= size+screenPaletteSize {
+			pens = body[size+screenMode3PensOffset : size+screenMode3PensOffset+4]
+		} else {
+			pens = pens[:4]
+		}
+	}
+	palette := make(color.Palette, len(pens))
+	for i, pen := range pens {
+		palette[i] = SAMColour(pen & 0x7f)
+	}
+	width := 256
+	if mode == 3 {
+		width = 512
+	}
+	img := image.NewPaletted(image.Rect(0, 0, width, screenHeight), palette)
+	for y := 0; y < screenHeight; y++ {
+		for x := 0; x < width; x++ {
+			img.Pix[y*img.Stride+x] = screenPen(body, mode, x, y)
+		}
+	}
+	return img, nil
+}
+
+// screenPen returns the pen (palette index) of pixel (x, y) of display
+// memory data in screen mode mode.
+func screenPen(data []byte, mode, x, y int) uint8 {
+	switch mode {
+	case 3:
+		return data[y*128+x/4] >> (6 - 2*(x%4)) & 0x03
+	case 4:
+		return data[y*128+x/2] >> (4 - 4*(x%2)) & 0x0f
+	}
+	var pixels, attribute uint8
+	if mode == 1 {
+		pixels = data[(y&0xc0)<<5|(y&0x07)<<8|(y&0x38)<<2|x/8]
+		attribute = data[6144+y/8*32+x/8]
+	} else {
+		pixels = data[y*32+x/8]
+		attribute = data[0x2000+y*32+x/8]
+	}
+	bright := attribute >> 3 & 0x08
+	if pixels>>(7-x%8)&1 == 1 {
+		return attribute&0x07 | bright
+	}
+	return attribute>>3&0x07 | bright
+}
+
+// Screen decodes the named FT_SCREEN file with DecodeScreen, in the
+// screen mode recorded in its directory entry. Returns an error if the
+// file is not present on disk, is not a SCREEN$ file, or can't be
+// decoded.
+func (di *DiskImage) Screen(name string) (*image.Paletted, error) {
+	dj := di.DiskJournal()
+	slot, err := dj.findFileEntry(name)
+	if err != nil {
+		return nil, err
+	}
+	return di.ReadScreen(dj[slot])
+}
+
+// ReadScreen decodes the FT_SCREEN file described by fe, as Screen
+// does.
+func (di *DiskImage) ReadScreen(fe *FileEntry) (*image.Paletted, error) {
+	if fe.Type != FT_SCREEN {
+		return nil, fmt.Errorf("file %v is %v, not Screen", fe.Name, fe.Type)
+	}
+	f, err := di.ReadFile(fe)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeScreen(f.Body, fe.ScreenMode())
+}
+
+// screenPage is the page a SCREEN$ file is recorded as loading to:
+// the ROM's first screen on a 512K SAM occupies pages 30 and 31.
+const screenPage = 30
+
+// EncodeScreen is the inverse of DecodeScreen: it encodes img as the
+// body of an FT_SCREEN file in screen mode mode (1–4), i.e. display
+// memory followed by a palette table and an empty line interrupt
+// table. Every pixel is mapped to the nearest colour of the SAM's
+// 128-colour palette, and the palette table holds the colours used.
+//
+// Returns an error if mode is not 1–4, if img is not 512×192 (mode 3)
+// or 256×192 (other modes), or if it can't be represented in that
+// mode: more than 4 colours in mode 3 or 16 in mode 4; in modes 1 and
+// 2, more than 2 colours in an attribute cell (8×8 pixels in mode 1,
+// 8×1 in mode 2), or colours that can't be split between the normal
+// and BRIGHT pens so that each cell's pair share a half.
+func EncodeScreen(img image.Image, mode int) ([]byte, error) {
+	if mode < 1 || mode > 4 {
+		return nil, fmt.Errorf("invalid screen mode %v (must be 1-4)", mode)
+	}
+	width := 256
+	if mode == 3 {
+		width = 512
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() != width || bounds.Dy() != screenHeight {
+		return nil, fmt.Errorf("mode %v screens are %v×%v pixels but image is %v×%v", mode, width, screenHeight, bounds.Dx(), bounds.Dy())
+	}
+	colours := make([][]uint8, screenHeight)
+	nearest := map[color.RGBA]uint8{}
+	for y := range colours {
+		colours[y] = make([]uint8, width)
+		for x := range colours[y] {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			rgb := color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), 0xff}
+			c, ok := nearest[rgb]
+			if !ok {
+				c = nearestSAMColour(rgb)
+				nearest[rgb] = c
+			}
+			colours[y][x] = c
+		}
+	}
+	size := screenSizes[mode]
+	body := make([]byte, size+screenPaletteSize+1)
+	pens := [20]uint8{}
+	var err error
+	switch mode {
+	case 1, 2:
+		err = encodeAttributeScreen(body, colours, mode, pens[:16])
+	default:
+		maxPens := 16
+		if mode == 3 {
+			maxPens = 4
+		}
+		penOf := map[uint8]uint8{}
+		for y, row := range colours {
+			for x, c := range row {
+				pen, ok := penOf[c]
+				if !ok {
+					if len(penOf) == maxPens {
+						return nil, fmt.Errorf("image has more than %v colours, the most mode %v allows", maxPens, mode)
+					}
+					pen = uint8(len(penOf))
+					penOf[c] = pen
+					pens[pen] = c
+				}
+				if mode == 3 {
+					body[y*128+x/4] |= pen << (6 - 2*(x%4))
+				} else {
+					body[y*128+x/2] |= pen << (4 - 4*(x%2))
+				}
+			}
+		}
+		if mode == 3 {
+			copy(pens[screenMode3PensOffset:], pens[:4])
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	copy(body[size:], pens[:])
+	copy(body[size+20:], pens[:])
+	body[size+screenPaletteSize] = 0xff
+	return body, nil
+}
+
+// nearestSAMColour returns the entry of the SAM's 128-colour palette
+// closest to c.
+func nearestSAMColour(c color.Color) uint8 {
+	r, g, b, _ := c.RGBA()
+	best, bestDistance := uint8(0), -1
+	for i := 0; i < 128; i++ {
+		s := SAMColour(uint8(i))
+		dr := int(r>>8) - int(s.R)
+		dg := int(g>>8) - int(s.G)
+		db := int(b>>8) - int(s.B)
+		if distance := dr*dr + dg*dg + db*db; bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = uint8(i), distance
+		}
+	}
+	return best
+}
+
+// encodeAttributeScreen writes the pixels and attributes of a mode 1
+// or mode 2 screen of SAM colours into body, and the 16 pens they use
+// into pens.
+func encodeAttributeScreen(body []byte, colours [][]uint8, mode int, pens []uint8) error {
+	cellHeight := 8
+	if mode == 2 {
+		cellHeight = 1
+	}
+	// Collect each cell's colours, and group colours that share a
+	// cell: they must be on the same (normal or BRIGHT) half of the
+	// pens.
+	cells := make([][][]uint8, screenHeight/cellHeight)
+	group := map[uint8]uint8{}
+	var find func(c uint8) uint8
+	find = func(c uint8) uint8 {
+		if group[c] != c {
+			group[c] = find(group[c])
+		}
+		return group[c]
+	}
+	for row := range cells {
+		cells[row] = make([][]uint8, 32)
+		for column := range cells[row] {
+			set := []uint8{}
+			for y := row * cellHeight; y < (row+1)*cellHeight; y++ {
+				for x := column * 8; x < column*8+8; x++ {
+					c := colours[y][x]
+					if _, ok := group[c]; !ok {
+						group[c] = c
+					}
+					if len(set) == 0 || (set[0] != c && (len(set) == 1 || set[1] != c)) {
+						set = append(set, c)
+					}
+					if len(set) > 2 {
+						return fmt.Errorf("attribute cell at (%v, %v) has more than 2 colours, the most mode %v allows", column*8, row*cellHeight, mode)
+					}
+				}
+			}
+			if len(set) == 2 {
+				group[find(set[1])] = find(set[0])
+			}
+			cells[row][column] = set
+		}
+	}
+	// Split the groups between the two halves of 8 pens, trying every
+	// assignment of groups to halves.
+	groups := map[uint8][]uint8{}
+	roots := []uint8{}
+	for c := uint8(0); c < 128; c++ {
+		if _, ok := group[c]; !ok {
+			continue
+		}
+		root := find(c)
+		if groups[root] == nil {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], c)
+	}
+	if len(group) > 16 {
+		return fmt.Errorf("image has %v colours but mode %v allows at most 16", len(group), mode)
+	}
+	split := -1
+	for assignment := 0; assignment < 1<<len(roots) && split < 0; assignment++ {
+		normal := 0
+		for i, root := range roots {
+			if assignment&(1<<i) == 0 {
+				normal += len(groups[root])
+			}
+		}
+		if normal <= 8 && len(group)-normal <= 8 {
+			split = assignment
+		}
+	}
+	if split < 0 {
+		return fmt.Errorf("image colours can't be split between the 8 normal and 8 BRIGHT pens of mode %v so that both colours of every attribute cell are on the same half", mode)
+	}
+	penOf := map[uint8]uint8{}
+	next := [2]uint8{0, 8}
+	for i, root := range roots {
+		half := split >> i & 1
+		for _, c := range groups[root] {
+			penOf[c] = next[half]
+			pens[next[half]] = c
+			next[half]++
+		}
+	}
+	for row := range cells {
+		for column, set := range cells[row] {
+			paper := penOf[set[0]]
+			ink := paper
+			if len(set) == 2 {
+				ink = penOf[set[1]]
+			}
+			attribute := paper&0x08<<3 | (paper&0x07)<<3 | ink&0x07
+			for y := row * cellHeight; y < (row+1)*cellHeight; y++ {
+				var pixels uint8
+				for x := 0; x < 8; x++ {
+					if colours[y][column*8+x] != set[0] {
+						pixels |= 0x80 >> x
+					}
+				}
+				if mode == 1 {
+					body[(y&0xc0)<<5|(y&0x07)<<8|(y&0x38)<<2|column] = pixels
+					body[6144+row*32+column] = attribute
+				} else {
+					body[y*32+column] = pixels
+					body[0x2000+y*32+column] = attribute
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// AddScreenFile encodes img with EncodeScreen and writes it to the disk
+// image as a new FT_SCREEN file named name, recorded as a mode mode
+// screen loading to the ROM's first screen on a 512K SAM. Returns an
+// error if img can't be encoded, if the disk has no free directory
+// slots, or if there are not enough free sectors to hold it.
+func (di *DiskImage) AddScreenFile(name string, img image.Image, mode int) error {
+	body, err := EncodeScreen(img, mode)
+	if err != nil {
+		return err
+	}
+	fe := &FileEntry{
+		Type:                   FT_SCREEN,
+		StartAddressPage:       screenPage,
+		StartAddressPageOffset: 0x8000,
+		ExecutionAddressDiv16K: 0xff,
+		ExecutionAddressMod16K: 0xffff,
+	}
+	fe.FileTypeInfo[0] = uint8(mode - 1)
+	return di.addFile(name, fe, body)
+}
@@ -0,0 +1,235 @@
+package samfile
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSAMColour(t *testing.T) {
+	for c, expected := range map[uint8]color.RGBA{
+		0:   {0, 0, 0, 0xff},
+		127: {0xff, 0xff, 0xff, 0xff},
+		8:   {0x24, 0x24, 0x24, 0xff},
+		34:  {0xdb, 0, 0, 0xff},
+		68:  {0, 0xdb, 0, 0xff},
+		1:   {0, 0, 0x49, 0xff},
+	} {
+		if actual := SAMColour(c); actual != expected {
+			t.Errorf("SAMColour(%v): expected %v, got %v", c, expected, actual)
+		}
+	}
+}
+
+func testScreenBody(mode int) []byte {
+	body := make([]byte, screenSizes[mode]+screenPaletteSize+1)
+	palette := body[screenSizes[mode]:]
+	for i := 0; i < 20; i++ {
+		palette[i] = uint8(i * 6)
+	}
+	body[len(body)-1] = 0xff
+	return body
+}
+
+func TestDecodeScreen(t *testing.T) {
+	type pixel struct {
+		x, y int
+		pen  uint8
+	}
+	for mode, test := range map[int]struct {
+		setup  func(body []byte)
+		width  int
+		pixels []pixel
+	}{
+		1: {
+			setup: func(body []byte) {
+				// Line 9 is the second pixel row of the second
+				// character row: offset 1<<8 | 1<<5.
+				body[0x120] = 0x40
+				body[6144+32] = 0x47 // BRIGHT, paper 0, ink 7
+				body[6144+33] = 0x0a // paper 1, ink 2
+			},
+			width:  256,
+			pixels: []pixel{{1, 9, 15}, {0, 9, 8}, {8, 9, 1}, {0, 0, 0}},
+		},
+		2: {
+			setup: func(body []byte) {
+				body[9*32] = 0x40
+				body[0x2000+9*32] = 0x0a
+			},
+			width:  256,
+			pixels: []pixel{{1, 9, 2}, {0, 9, 1}, {0, 8, 0}},
+		},
+		3: {
+			setup: func(body []byte) {
+				body[5*128+1] = 0x1b // pens 0, 1, 2, 3
+			},
+			width:  512,
+			pixels: []pixel{{4, 5, 0}, {5, 5, 1}, {6, 5, 2}, {7, 5, 3}},
+		},
+		4: {
+			setup: func(body []byte) {
+				body[191*128+127] = 0x9f
+			},
+			width:  256,
+			pixels: []pixel{{254, 191, 9}, {255, 191, 15}, {0, 0, 0}},
+		},
+	} {
+		body := testScreenBody(mode)
+		test.setup(body)
+		img, err := DecodeScreen(body, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bounds := img.Bounds(); bounds.Dx() != test.width || bounds.Dy() != 192 {
+			t.Errorf("mode %v: expected %v×192 image, got %v", mode, test.width, bounds)
+		}
+		for _, p := range test.pixels {
+			if pen := img.ColorIndexAt(p.x, p.y); pen != p.pen {
+				t.Errorf("mode %v: pixel (%v, %v): expected pen %v, got %v", mode, p.x, p.y, p.pen, pen)
+			}
+		}
+		pens := 16
+		first := uint8(0)
+		if mode == 3 {
+			pens = 4
+			first = 16 * 6
+		}
+		if len(img.Palette) != pens || img.Palette[0] != SAMColour(first) {
+			t.Errorf("mode %v: expected %v pens starting %v, got %v", mode, pens, SAMColour(first), img.Palette)
+		}
+	}
+}
+
+func TestDecodeScreenErrors(t *testing.T) {
+	if _, err := DecodeScreen(make([]byte, 24576), 5); err == nil {
+		t.Errorf("expected error for mode 5")
+	}
+	if _, err := DecodeScreen(make([]byte, 6911), 1); err == nil {
+		t.Errorf("expected error for truncated mode 1 screen")
+	}
+	img, err := DecodeScreen(make([]byte, 24576), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Palette[15] != SAMColour(127) {
+		t.Errorf("expected default palette for screen without palette table")
+	}
+}
+
+func TestDiskImageScreen(t *testing.T) {
+	di := NewDiskImage()
+	body := testScreenBody(4)
+	body[0] = 0x12
+	fe := &FileEntry{Type: FT_SCREEN, StartAddressPage: 0x1e, StartAddressPageOffset: 0x8000}
+	fe.FileTypeInfo[0] = 3
+	if err := di.addFile("screen", fe, body); err != nil {
+		t.Fatal(err)
+	}
+	if err := di.AddCodeFile("code", body, 0x8000, 0); err != nil {
+		t.Fatal(err)
+	}
+	img, err := di.Screen("SCREEN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pen := img.ColorIndexAt(1, 0); pen != 2 {
+		t.Errorf("expected pen 2, got %v", pen)
+	}
+	if _, err := di.Screen("code"); err == nil {
+		t.Errorf("expected error decoding a code file as a screen")
+	}
+}
+
+func TestEncodeScreenRoundTrip(t *testing.T) {
+	for mode := 1; mode <= 4; mode++ {
+		body := testScreenBody(mode)
+		palette := body[screenSizes[mode]:]
+		switch mode {
+		case 1, 2:
+			// Normal pens 0-7 and BRIGHT pens 8-15 must be distinct
+			// colours for a lossless round trip.
+			for i := 0; i < 16; i++ {
+				palette[i] = uint8(i*8 + i/8)
+			}
+			for i := 0; i < 768; i++ {
+				body[i*7%6144] = uint8(i * 37)
+				body[len(body)-screenPaletteSize-1-i] = uint8(i*11) & 0x7f
+			}
+			if mode == 2 {
+				for i := 0; i < 6144; i++ {
+					body[i] = uint8(i * 13)
+					body[0x2000+i] = uint8(i*29) & 0x7f
+				}
+			}
+		default:
+			for i := 0; i < 24576; i++ {
+				body[i] = uint8(i * 7)
+			}
+		}
+		img, err := DecodeScreen(body, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := EncodeScreen(img, mode)
+		if err != nil {
+			t.Fatalf("mode %v: %v", mode, err)
+		}
+		decoded, err := DecodeScreen(encoded, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bounds := img.Bounds()
+		for y := 0; y < bounds.Dy(); y++ {
+			for x := 0; x < bounds.Dx(); x++ {
+				if img.At(x, y) != decoded.At(x, y) {
+					t.Fatalf("mode %v: pixel (%v, %v) was %v but is %v after round trip", mode, x, y, img.At(x, y), decoded.At(x, y))
+				}
+			}
+		}
+		if len(encoded) != screenSizes[mode]+screenPaletteSize+1 || encoded[len(encoded)-1] != 0xff {
+			t.Errorf("mode %v: expected %v byte body ending 0xff", mode, screenSizes[mode]+screenPaletteSize+1)
+		}
+	}
+}
+
+func TestEncodeScreenErrors(t *testing.T) {
+	newImage := func(width int, colours ...color.Color) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, width, 192))
+		for i, c := range colours {
+			img.Set(i, 0, c)
+		}
+		return img
+	}
+	grey := func(i int) color.Color {
+		return SAMColour(uint8(i))
+	}
+	many := []color.Color{}
+	for i := 0; i < 17; i++ {
+		many = append(many, grey(i*7))
+	}
+	for name, test := range map[string]struct {
+		img  image.Image
+		mode int
+	}{
+		"wrong size":              {newImage(512), 4},
+		"wrong size for mode 3":   {newImage(256), 3},
+		"too many colours mode 3": {newImage(512, many[:5]...), 3},
+		"too many colours mode 4": {newImage(256, many...), 4},
+		"three colours in a cell": {newImage(256, many[1:3]...), 1},
+		"bad mode":                {newImage(256), 0},
+	} {
+		if _, err := EncodeScreen(test.img, test.mode); err == nil {
+			t.Errorf("%v: expected error", name)
+		}
+	}
+	// Nine colours, each sharing a cell with black, can't be split
+	// between the normal and BRIGHT halves.
+	img := newImage(256)
+	for i := 0; i < 9; i++ {
+		img.Set(i*8, 0, grey(i*9+1))
+	}
+	if _, err := EncodeScreen(img, 2); err == nil {
+		t.Errorf("expected error for colours that can't be split between halves")
+	}
+}
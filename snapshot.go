@@ -0,0 +1,378 @@
+package samfile
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// FT_ZX_SNAPSHOT files are 48K ZX Spectrum snapshots in the layout of
+// the MGT +D interface, whose file types SAMDOS inherited. The body is
+// a raw dump of the 48K of RAM at 0x4000–0xFFFF, with no FileHeader,
+// filling 97 sectors. The directory bytes that hold the FileHeader
+// mirror for other file types (0xDC–0xF1) instead hold the register
+// block, as little-endian words:
+//
+//	0xDC IY     0xDE IX     0xE0 DE'    0xE2 BC'    0xE4 HL'
+//	0xE6 AF'    0xE8 DE     0xEA BC     0xEC HL
+//	0xEE IFF (the F register after LD A,I: bit 2 is IFF2)
+//	0xEF I      0xF0 SP
+//
+// The remaining registers are on the Spectrum's stack, pushed by the
+// NMI that took the snapshot and its handler: from SP upwards, R (in
+// the high byte of the word pushed last), then AF, then PC. The saved
+// SP points below them. Neither the interrupt mode nor the border
+// colour is saved: the loader picks IM 2 unless I is 0x00 or 0x3F (IM
+// 1), and the border is taken to be white.
+const (
+	snapshotRegisters = 0xdc
+	snapshotRAMStart  = 0x4000
+
+	// SnapshotLength is the length of the body of an FT_ZX_SNAPSHOT
+	// file: the 48K ZX Spectrum's RAM.
+	SnapshotLength = 0xc000
+)
+
+// .sna and .z80 layouts, per https://worldofspectrum.org/faq/reference/formats.htm:
+//
+// A .sna file is a 27-byte header (I, HL', DE', BC', AF', HL, DE, BC,
+// IY, IX, IFF2 in bit 2, R, AF, SP, IM, border) followed by the 48K of
+// RAM, with PC pushed onto the stack.
+//
+// A version 1 .z80 file is a 30-byte header (A, F, BC, HL, PC, SP, I,
+// R, flags, DE, BC', DE', HL', A', F', IY, IX, IFF1, IFF2, IM in bits
+// 0–1) followed by the 48K of RAM. The flags byte holds bit 7 of R in
+// bit 0, the border colour in bits 1–3 and, in bit 5, whether the RAM
+// is compressed: runs of 5 or more equal bytes, and runs of 2 or more
+// 0xED bytes, are stored as ED ED count byte, and the data ends with
+// 00 ED ED 00. Later versions have PC = 0 in the first header.
+const (
+	snaHeaderLength = 27
+	z80HeaderLength = 30
+)
+
+// Snapshot is the state of a 48K ZX Spectrum: its Z80 registers,
+// interrupt state, border colour and 48K of RAM. The Alt registers are
+// the Z80's alternate (primed) register set.
+type Snapshot struct {
+	AF, BC, DE, HL             uint16
+	AltAF, AltBC, AltDE, AltHL uint16
+	IX, IY, SP, PC             uint16
+	I, R                       uint8
+	IFF1, IFF2                 bool
+	IM                         uint8
+	Border                     uint8
+	// RAM holds memory 0x4000–0xFFFF.
+	RAM [SnapshotLength]byte
+}
+
+// Snapshot reads the named FT_ZX_SNAPSHOT file out of the disk image.
+func (di *DiskImage) Snapshot(name string) (*Snapshot, error) {
+	dj := di.DiskJournal()
+	slot, err := dj.findFileEntry(name)
+	if err != nil {
+		return nil, err
+	}
+	return di.ReadSnapshot(dj[slot])
+}
+
+// ReadSnapshot reads the FT_ZX_SNAPSHOT file described by directory
+// entry fe: the registers from the directory entry and the stack, and
+// the RAM from the file body. Returns an error if fe is not a snapshot,
+// if its body is shorter than SnapshotLength, or if its stack pointer
+// leaves no room for the stacked registers in RAM.
+func (di *DiskImage) ReadSnapshot(fe *FileEntry) (*Snapshot, error) {
+	if fe.Type != FT_ZX_SNAPSHOT {
+		return nil, fmt.Errorf("file %q is a %v file, not a ZX snapshot", fe.Name.String(), fe.Type)
+	}
+	chain, kind, description := di.sectorChain(fe.FirstSector)
+	if len(chain)*510 < SnapshotLength {
+		if kind != "" {
+			return nil, fmt.Errorf("file %q has a broken sector chain (%v: %v)", fe.Name.String(), kind, description)
+		}
+		return nil, fmt.Errorf("file %q is %v bytes long but a ZX snapshot is %v bytes", fe.Name.String(), len(chain)*510, SnapshotLength)
+	}
+	s := &Snapshot{Border: 7}
+	for i, sector := range chain[:(SnapshotLength+509)/510] {
+		sd, _ := di.SectorData(sector)
+		copy(s.RAM[i*510:], sd[:510])
+	}
+	raw := fe.Raw()
+	r := raw[snapshotRegisters:]
+	word := func(i int) uint16 {
+		return uint16(r[i]) | uint16(r[i+1])<<8
+	}
+	s.IY, s.IX = word(0), word(2)
+	s.AltDE, s.AltBC, s.AltHL, s.AltAF = word(4), word(6), word(8), word(10)
+	s.DE, s.BC, s.HL = word(12), word(14), word(16)
+	s.IFF1 = r[18]&0x04 != 0
+	s.IFF2 = s.IFF1
+	s.I = r[19]
+	s.SP = word(20)
+	s.IM = 2
+	if s.I == 0x00 || s.I == 0x3f {
+		s.IM = 1
+	}
+	ir, err := s.pop()
+	if err != nil {
+		return nil, fmt.Errorf("file %q: %v", fe.Name.String(), err)
+	}
+	s.R = uint8(ir >> 8)
+	if s.AF, err = s.pop(); err != nil {
+		return nil, fmt.Errorf("file %q: %v", fe.Name.String(), err)
+	}
+	if s.PC, err = s.pop(); err != nil {
+		return nil, fmt.Errorf("file %q: %v", fe.Name.String(), err)
+	}
+	return s, nil
+}
+
+// AddSnapshot writes s to the disk image as a new FT_ZX_SNAPSHOT file
+// named name, pushing R, AF and PC onto a copy of its stack (see
+// ReadSnapshot). IM and Border are not saved. Returns an error if the
+// stack pointer leaves no room for them in RAM, if the disk has no
+// free directory slots, or if there are not enough free sectors to
+// hold it.
+func (di *DiskImage) AddSnapshot(name string, s *Snapshot) error {
+	c := *s
+	iff := uint8(0)
+	if c.IFF2 {
+		iff = 0x04
+	}
+	for _, word := range []uint16{c.PC, c.AF, uint16(c.R)<<8 | uint16(iff)} {
+		if err := c.push(word); err != nil {
+			return fmt.Errorf("cannot add snapshot %q: %v", name, err)
+		}
+	}
+	raw := [0x100]byte{}
+	for i, word := range []uint16{c.IY, c.IX, c.AltDE, c.AltBC, c.AltHL, c.AltAF, c.DE, c.BC, c.HL, uint16(c.I)<<8 | uint16(iff), c.SP} {
+		raw[snapshotRegisters+2*i] = byte(word)
+		raw[snapshotRegisters+2*i+1] = byte(word >> 8)
+	}
+	fe := FileEntryFrom(raw)
+	fe.Type = FT_ZX_SNAPSHOT
+	return di.addRawFile(name, fe, c.RAM[:])
+}
+
+// push pushes word onto the stack in s.RAM, as the Z80's PUSH does.
+func (s *Snapshot) push(word uint16) error {
+	if s.SP-2 < snapshotRAMStart || s.SP-1 < snapshotRAMStart {
+		return fmt.Errorf("stack pointer 0x%04x leaves no room in RAM to push registers", s.SP)
+	}
+	s.SP -= 2
+	s.RAM[s.SP-snapshotRAMStart] = byte(word)
+	s.RAM[s.SP+1-snapshotRAMStart] = byte(word >> 8)
+	return nil
+}
+
+// pop pops a word off the stack in s.RAM, as the Z80's POP does.
+func (s *Snapshot) pop() (uint16, error) {
+	if s.SP < snapshotRAMStart || s.SP+1 < snapshotRAMStart {
+		return 0, fmt.Errorf("stack pointer 0x%04x is not in RAM so registers can't be popped from it", s.SP)
+	}
+	word := uint16(s.RAM[s.SP-snapshotRAMStart]) | uint16(s.RAM[s.SP+1-snapshotRAMStart])<<8
+	s.SP += 2
+	return word, nil
+}
+
+// SnapshotFromSNA converts the contents of a 48K .sna file to a
+// Snapshot, popping PC off its stack.
+func SnapshotFromSNA(data []byte) (*Snapshot, error) {
+	if len(data) != snaHeaderLength+SnapshotLength {
+		return nil, fmt.Errorf(".sna file is %v bytes but a 48K .sna file is %v bytes", len(data), snaHeaderLength+SnapshotLength)
+	}
+	word := func(i int) uint16 {
+		return uint16(data[i]) | uint16(data[i+1])<<8
+	}
+	s := &Snapshot{
+		I:      data[0],
+		AltHL:  word(1),
+		AltDE:  word(3),
+		AltBC:  word(5),
+		AltAF:  word(7),
+		HL:     word(9),
+		DE:     word(11),
+		BC:     word(13),
+		IY:     word(15),
+		IX:     word(17),
+		IFF1:   data[19]&0x04 != 0,
+		IFF2:   data[19]&0x04 != 0,
+		R:      data[20],
+		AF:     word(21),
+		SP:     word(23),
+		IM:     data[25] & 0x03,
+		Border: data[26] & 0x07,
+	}
+	copy(s.RAM[:], data[snaHeaderLength:])
+	pc, err := s.pop()
+	if err != nil {
+		return nil, err
+	}
+	s.PC = pc
+	return s, nil
+}
+
+// SNA encodes s as a 48K .sna file, pushing PC onto a copy of its
+// stack. Returns an error if the stack pointer leaves no room for it
+// in RAM.
+func (s *Snapshot) SNA() ([]byte, error) {
+	c := *s
+	if err := c.push(c.PC); err != nil {
+		return nil, err
+	}
+	iff := uint8(0)
+	if c.IFF2 {
+		iff = 0x04
+	}
+	data := make([]byte, snaHeaderLength, snaHeaderLength+SnapshotLength)
+	data[0] = c.I
+	for i, word := range []uint16{c.AltHL, c.AltDE, c.AltBC, c.AltAF, c.HL, c.DE, c.BC, c.IY, c.IX} {
+		data[1+2*i] = byte(word)
+		data[2+2*i] = byte(word >> 8)
+	}
+	data[19] = iff
+	data[20] = c.R
+	data[21], data[22] = byte(c.AF), byte(c.AF>>8)
+	data[23], data[24] = byte(c.SP), byte(c.SP>>8)
+	data[25] = c.IM
+	data[26] = c.Border
+	return append(data, c.RAM[:]...), nil
+}
+
+// SnapshotFromZ80 converts the contents of a version 1 .z80 file,
+// compressed or not, to a Snapshot. Returns an error for later
+// versions of the format, which have PC = 0 in the version 1 header.
+func SnapshotFromZ80(data []byte) (*Snapshot, error) {
+	if len(data) < z80HeaderLength {
+		return nil, fmt.Errorf(".z80 file is only %v bytes long", len(data))
+	}
+	word := func(i int) uint16 {
+		return uint16(data[i]) | uint16(data[i+1])<<8
+	}
+	flags := data[12]
+	if flags == 0xff {
+		flags = 1
+	}
+	s := &Snapshot{
+		AF:     uint16(data[0])<<8 | uint16(data[1]),
+		BC:     word(2),
+		HL:     word(4),
+		PC:     word(6),
+		SP:     word(8),
+		I:      data[10],
+		R:      data[11]&0x7f | flags<<7,
+		Border: flags >> 1 & 0x07,
+		DE:     word(13),
+		AltBC:  word(15),
+		AltDE:  word(17),
+		AltHL:  word(19),
+		AltAF:  uint16(data[21])<<8 | uint16(data[22]),
+		IY:     word(23),
+		IX:     word(25),
+		IFF1:   data[27] != 0,
+		IFF2:   data[28] != 0,
+		IM:     data[29] & 0x03,
+	}
+	if s.PC == 0 {
+		return nil, fmt.Errorf(".z80 file is version 2 or later; only version 1 .z80 files are supported")
+	}
+	ram := data[z80HeaderLength:]
+	if flags&0x20 != 0 {
+		var err error
+		if ram, err = z80Decompress(ram); err != nil {
+			return nil, err
+		}
+	}
+	if len(ram) != SnapshotLength {
+		return nil, fmt.Errorf(".z80 file holds %v bytes of RAM but a 48K snapshot has %v", len(ram), SnapshotLength)
+	}
+	copy(s.RAM[:], ram)
+	return s, nil
+}
+
+// Z80 encodes s as a compressed version 1 .z80 file.
+func (s *Snapshot) Z80() []byte {
+	data := make([]byte, z80HeaderLength)
+	word := func(i int, w uint16) {
+		data[i], data[i+1] = byte(w), byte(w>>8)
+	}
+	data[0], data[1] = byte(s.AF>>8), byte(s.AF)
+	word(2, s.BC)
+	word(4, s.HL)
+	word(6, s.PC)
+	word(8, s.SP)
+	data[10] = s.I
+	data[11] = s.R & 0x7f
+	data[12] = s.R>>7 | (s.Border&0x07)<<1 | 0x20
+	word(13, s.DE)
+	word(15, s.AltBC)
+	word(17, s.AltDE)
+	word(19, s.AltHL)
+	data[21], data[22] = byte(s.AltAF>>8), byte(s.AltAF)
+	word(23, s.IY)
+	word(25, s.IX)
+	if s.IFF1 {
+		data[27] = 1
+	}
+	if s.IFF2 {
+		data[28] = 1
+	}
+	data[29] = s.IM & 0x03
+	return append(data, z80Compress(s.RAM[:])...)
+}
+
+// z80Compress compresses the RAM of a version 1 .z80 file. A byte
+// directly following a single 0xED is never the start of a run.
+func z80Compress(ram []byte) []byte {
+	out := bytes.Buffer{}
+	for i := 0; i < len(ram); {
+		b := ram[i]
+		run := 1
+		for i+run < len(ram) && ram[i+run] == b && run < 0xff {
+			run++
+		}
+		switch {
+		case run >= 5 || b == 0xed && run >= 2:
+			out.Write([]byte{0xed, 0xed, byte(run), b})
+			i += run
+		case b == 0xed:
+			out.WriteByte(b)
+			i++
+			if i < len(ram) {
+				out.WriteByte(ram[i])
+				i++
+			}
+		default:
+			out.WriteByte(b)
+			i++
+		}
+	}
+	out.Write([]byte{0x00, 0xed, 0xed, 0x00})
+	return out.Bytes()
+}
+
+// z80Decompress decompresses the RAM of a version 1 .z80 file, which
+// ends with the marker 00 ED ED 00.
+func z80Decompress(data []byte) ([]byte, error) {
+	marker := []byte{0x00, 0xed, 0xed, 0x00}
+	if !bytes.HasSuffix(data, marker) {
+		return nil, fmt.Errorf(".z80 file has no end marker")
+	}
+	data = data[:len(data)-len(marker)]
+	ram := make([]byte, 0, SnapshotLength)
+	for i := 0; i < len(data); {
+		if i+1 < len(data) && data[i] == 0xed && data[i+1] == 0xed {
+			if i+4 > len(data) {
+				return nil, fmt.Errorf(".z80 file ends inside a compressed block")
+			}
+			ram = append(ram, bytes.Repeat([]byte{data[i+3]}, int(data[i+2]))...)
+			i += 4
+		} else {
+			ram = append(ram, data[i])
+			i++
+		}
+		if len(ram) > SnapshotLength {
+			return nil, fmt.Errorf(".z80 file decompresses to more than %v bytes", SnapshotLength)
+		}
+	}
+	return ram, nil
+}
@@ -0,0 +1,170 @@
+package samfile
+
+import (
+	"bytes"
+	"io/fs"
+	"testing"
+)
+
+func testSnapshot() *Snapshot {
+	s := &Snapshot{
+		AF: 0x1234, BC: 0x2345, DE: 0x3456, HL: 0x4567,
+		AltAF: 0x5678, AltBC: 0x6789, AltDE: 0x789a, AltHL: 0x89ab,
+		IX: 0x9abc, IY: 0x5c3a, SP: 0xff50, PC: 0x8000,
+		I: 0x3f, R: 0xa5, IFF1: true, IFF2: true, IM: 1, Border: 7,
+	}
+	for i := range s.RAM {
+		s.RAM[i] = byte(i / 300)
+	}
+	// Runs of 0xED and single 0xED followed by a run exercise the
+	// .z80 compression rules.
+	copy(s.RAM[0x1000:], []byte{0xed, 0xed, 0x00, 0xed, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xed})
+	return s
+}
+
+// sameSnapshot reports how got differs from want, ignoring the 6 bytes
+// below the stack pointer where registers may have been pushed.
+func sameSnapshot(t *testing.T, context string, got, want *Snapshot) {
+	t.Helper()
+	g, w := *got, *want
+	for i := 1; i <= 6; i++ {
+		g.RAM[w.SP-uint16(i)-0x4000] = 0
+		w.RAM[w.SP-uint16(i)-0x4000] = 0
+	}
+	if g.RAM != w.RAM {
+		t.Errorf("%v: RAM differs", context)
+	}
+	g.RAM, w.RAM = [SnapshotLength]byte{}, [SnapshotLength]byte{}
+	if g != w {
+		t.Errorf("%v: expected registers %+v, got %+v", context, w, g)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	s := testSnapshot()
+	di := NewDiskImage()
+	if err := di.AddSnapshot("game", s); err != nil {
+		t.Fatal(err)
+	}
+	fe := di.DiskJournal()[0]
+	if fe.Type != FT_ZX_SNAPSHOT || fe.Sectors != 97 {
+		t.Errorf("expected a 97-sector ZX snapshot, got %v with %v sectors", fe.Type, fe.Sectors)
+	}
+	if problems := di.Check(); len(problems) != 0 {
+		t.Errorf("unexpected problems: %v", problems)
+	}
+	if changes := di.Repair(); len(changes) != 0 {
+		t.Errorf("unexpected repairs: %v", changes)
+	}
+	read, err := di.Snapshot("GAME")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameSnapshot(t, "disk round trip", read, s)
+	// The stacked registers are below SP, in RAM.
+	raw := fe.Raw()
+	if sp := uint16(raw[0xf0]) | uint16(raw[0xf1])<<8; sp != s.SP-6 {
+		t.Errorf("expected SP 0x%04x in the directory, got 0x%04x", s.SP-6, sp)
+	}
+
+	sna, err := s.SNA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sna) != 49179 {
+		t.Errorf("expected a 49179 byte .sna file, got %v bytes", len(sna))
+	}
+	fromSNA, err := SnapshotFromSNA(sna)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameSnapshot(t, ".sna round trip", fromSNA, s)
+
+	z80 := s.Z80()
+	if len(z80) >= 30+SnapshotLength {
+		t.Errorf("expected compressed .z80 file, got %v bytes", len(z80))
+	}
+	fromZ80, err := SnapshotFromZ80(z80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameSnapshot(t, ".z80 round trip", fromZ80, s)
+}
+
+func TestZ80Uncompressed(t *testing.T) {
+	s := testSnapshot()
+	z80 := s.Z80()
+	header := append([]byte{}, z80[:30]...)
+	header[12] &^= 0x20
+	fromZ80, err := SnapshotFromZ80(append(header, s.RAM[:]...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameSnapshot(t, "uncompressed .z80", fromZ80, s)
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	s := testSnapshot()
+	s.SP = 0x4003
+	if err := NewDiskImage().AddSnapshot("game", s); err == nil {
+		t.Errorf("expected an error adding a snapshot with no room on its stack")
+	}
+	if _, err := s.SNA(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	s.SP = 0x4001
+	if _, err := s.SNA(); err == nil {
+		t.Errorf("expected an error writing a .sna file with no room on its stack")
+	}
+	if _, err := SnapshotFromSNA(make([]byte, 100)); err == nil {
+		t.Errorf("expected an error for a short .sna file")
+	}
+	z80 := testSnapshot().Z80()
+	v2 := append([]byte{}, z80...)
+	v2[6], v2[7] = 0, 0
+	if _, err := SnapshotFromZ80(v2); err == nil {
+		t.Errorf("expected an error for a version 2 .z80 file")
+	}
+	if _, err := SnapshotFromZ80(z80[:len(z80)-4]); err == nil {
+		t.Errorf("expected an error for a .z80 file with no end marker")
+	}
+	short := append(append([]byte{}, z80[:100]...), 0x00, 0xed, 0xed, 0x00)
+	if _, err := SnapshotFromZ80(short); err == nil {
+		t.Errorf("expected an error for a truncated .z80 file")
+	}
+
+	di := NewDiskImage()
+	if err := di.AddCodeFile("code", bytes.Repeat([]byte{1}, 100), 0x8000, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := di.Snapshot("code"); err == nil {
+		t.Errorf("expected an error reading a code file as a snapshot")
+	}
+}
+
+func TestSnapshotReadFile(t *testing.T) {
+	s := testSnapshot()
+	s.SP = 0xff00
+	di := NewDiskImage()
+	if err := di.AddSnapshot("SNAP", s); err != nil {
+		t.Fatal(err)
+	}
+	read, err := di.Snapshot("SNAP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := di.File("SNAP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.Body, read.RAM[:]) || f.Header.Length() != SnapshotLength {
+		t.Errorf("expected ReadFile to return the %v bytes of RAM, got %v bytes", SnapshotLength, len(f.Body))
+	}
+	body, err := fs.ReadFile(di.FS(), "SNAP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, read.RAM[:]) {
+		t.Errorf("expected fs.ReadFile to return the %v bytes of RAM, got %v bytes", SnapshotLength, len(body))
+	}
+}
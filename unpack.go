@@ -0,0 +1,433 @@
+package samfile
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ManifestName is the name of the manifest Unpack writes and
+	// Pack reads.
+	ManifestName = "manifest.json"
+	// unallocatedFile holds the contents of Manifest.Unallocated.
+	unallocatedFile = "unallocated.bin"
+)
+
+type (
+	// Manifest describes everything on a disk image other than the
+	// file bodies, so that Pack can rebuild the image byte for byte
+	// from the directory Unpack writes. Byte fields are hex strings.
+	Manifest struct {
+		Files []*ManifestFile `json:"files"`
+		// UnusedSlots holds the unused directory slots that aren't
+		// all zeros, such as the entries of erased files.
+		UnusedSlots []*ManifestSlot `json:"unused_slots,omitempty"`
+		// Unallocated lists the data sectors that are in no file's
+		// sector chain and aren't all zeros, such as the sectors of
+		// erased files. Their contents are in unallocated.bin, in
+		// the order listed.
+		Unallocated []*SectorRun `json:"unallocated,omitempty"`
+	}
+
+	// ManifestFile is a used directory slot of a Manifest: every
+	// field of its FileEntry, the sectors of its chain, and the bytes
+	// of the chain other than the body, which is kept in File.
+	ManifestFile struct {
+		Slot int `json:"slot"`
+		// File is the name of the file holding the body, relative
+		// to the manifest.
+		File string `json:"file"`
+		// Name is all 10 bytes of the filename, padding included,
+		// one character per byte (bytes 0x80–0xFF as U+0080–U+00FF).
+		Name                   string   `json:"name"`
+		Type                   FileType `json:"type"`
+		Attributes             []string `json:"attributes"`
+		Sectors                uint16   `json:"sectors"`
+		FirstTrack             uint8    `json:"first_track"`
+		FirstSector            uint8    `json:"first_sector"`
+		FileTypeInfo           string   `json:"file_type_info"`
+		StartAddressPage       uint8    `json:"start_address_page"`
+		StartAddressPageOffset uint16   `json:"start_address_page_offset"`
+		Pages                  uint8    `json:"pages"`
+		LengthMod16K           uint16   `json:"length_mod_16k"`
+		ExecutionAddressDiv16K uint8    `json:"execution_address_div_16k"`
+		ExecutionAddressMod16K uint16   `json:"execution_address_mod_16k"`
+		MGTFlags               uint8    `json:"mgt_flags"`
+		MGTFutureAndPast       string   `json:"mgt_future_and_past"`
+		ReservedA              string   `json:"reserved_a"`
+		ReservedB              string   `json:"reserved_b"`
+		// SectorAddressMap is only set if it differs from the map of
+		// the sectors in Chain.
+		SectorAddressMap string `json:"sector_address_map,omitempty"`
+		// Chain lists the sectors of the file's sector chain, in
+		// chain order, as far as the chain is valid.
+		Chain []*SectorRun `json:"chain"`
+		// Header is the 9-byte FileHeader at the start of the chain
+		// (empty for an FT_ZX_SNAPSHOT file, which has none).
+		Header string `json:"header,omitempty"`
+		// Slack is the rest of the chain after the body, less any
+		// trailing zeros.
+		Slack string `json:"slack,omitempty"`
+		// EndLink is the link in the last sector of the chain, if
+		// not 0000.
+		EndLink string `json:"end_link,omitempty"`
+	}
+
+	// ManifestSlot is an unused directory slot of a Manifest.
+	ManifestSlot struct {
+		Slot int `json:"slot"`
+		// Raw is the slot's 256 bytes.
+		Raw string `json:"raw"`
+	}
+
+	// SectorRun is Count consecutive data sectors (in the order of
+	// SectorAddressMap bits) starting at Track, Sector.
+	SectorRun struct {
+		Track  uint8 `json:"track"`
+		Sector uint8 `json:"sector"`
+		Count  int   `json:"count"`
+	}
+)
+
+// sectorRuns returns sectors as runs of consecutive data sectors.
+func sectorRuns(sectors []*Sector) []*SectorRun {
+	runs := []*SectorRun{}
+	for i, sector := range sectors {
+		if i > 0 && sector.mapIndex() == sectors[i-1].mapIndex()+1 {
+			runs[len(runs)-1].Count++
+			continue
+		}
+		runs = append(runs, &SectorRun{Track: sector.Track, Sector: sector.Sector, Count: 1})
+	}
+	return runs
+}
+
+// runSectors returns the sectors of runs, or an error if they run outside
+// the data area.
+func runSectors(runs []*SectorRun) ([]*Sector, error) {
+	sectors := []*Sector{}
+	for _, run := range runs {
+		first := &Sector{Track: run.Track, Sector: run.Sector}
+		if err := checkDataSector(first); err != nil {
+			return nil, err
+		}
+		if run.Count < 1 || first.mapIndex()+run.Count > DataSectors {
+			return nil, fmt.Errorf("run of %v sectors from %v is outside the data area", run.Count, first)
+		}
+		for i := 0; i < run.Count; i++ {
+			sectors = append(sectors, DataSector(first.mapIndex()+i))
+		}
+	}
+	return sectors, nil
+}
+
+// latin1 returns b as a string of one rune per byte.
+func latin1(b []byte) string {
+	runes := []rune{}
+	for _, c := range b {
+		runes = append(runes, rune(c))
+	}
+	return string(runes)
+}
+
+// unpackFileName returns the name of the body file of slot slot, file
+// name: the slot number and trimmed name, with any characters that
+// aren't safe in a host filename replaced by '_'.
+func unpackFileName(slot int, name Filename) string {
+	safe := strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name.String())
+	return fmt.Sprintf("%02d-%v", slot, safe)
+}
+
+// Unpack writes every file of di to directory dir (created if need
+// be), one file per body, together with a Manifest (manifest.json)
+// describing everything else on the disk, and the contents of any
+// unallocated sectors that aren't all zeros (unallocated.bin). Pack
+// rebuilds di from dir.
+func (di *DiskImage) Unpack(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	manifest := &Manifest{Files: []*ManifestFile{}}
+	dj := di.DiskJournal()
+	inChain := map[Sector]bool{}
+	for slot, fe := range dj {
+		if !fe.Used() {
+			raw := fe.Raw()
+			if raw != [0x100]byte{} {
+				manifest.UnusedSlots = append(manifest.UnusedSlots, &ManifestSlot{Slot: slot, Raw: hex.EncodeToString(raw[:])})
+			}
+			continue
+		}
+		chain, _, _ := di.sectorChain(fe.FirstSector)
+		data := []byte{}
+		for _, sector := range chain {
+			inChain[*sector] = true
+			sectorData, _ := di.SectorData(sector)
+			data = append(data, sectorData[:510]...)
+		}
+		headerLength, bodyLength := 9, int(fe.Length())
+		if fe.Type == FT_ZX_SNAPSHOT {
+			headerLength, bodyLength = 0, SnapshotLength
+		}
+		if headerLength > len(data) {
+			headerLength = len(data)
+		}
+		if bodyLength > len(data)-headerLength {
+			bodyLength = len(data) - headerLength
+		}
+		attributes := []string{}
+		if fe.Attributes != 0 {
+			attributes = strings.Split(fe.Attributes.String(), ", ")
+		}
+		mf := &ManifestFile{
+			Slot:                   slot,
+			File:                   unpackFileName(slot, fe.Name),
+			Name:                   latin1(fe.Name[:]),
+			Type:                   fe.Type,
+			Attributes:             attributes,
+			Sectors:                fe.Sectors,
+			FirstTrack:             fe.FirstSector.Track,
+			FirstSector:            fe.FirstSector.Sector,
+			FileTypeInfo:           hex.EncodeToString(fe.FileTypeInfo[:]),
+			StartAddressPage:       fe.StartAddressPage,
+			StartAddressPageOffset: fe.StartAddressPageOffset,
+			Pages:                  fe.Pages,
+			LengthMod16K:           fe.LengthMod16K,
+			ExecutionAddressDiv16K: fe.ExecutionAddressDiv16K,
+			ExecutionAddressMod16K: fe.ExecutionAddressMod16K,
+			MGTFlags:               fe.MGTFlags,
+			MGTFutureAndPast:       hex.EncodeToString(fe.MGTFutureAndPast[:]),
+			ReservedA:              hex.EncodeToString(fe.ReservedA[:]),
+			ReservedB:              hex.EncodeToString(fe.ReservedB[:]),
+			Chain:                  sectorRuns(chain),
+			Header:                 hex.EncodeToString(data[:headerLength]),
+			Slack:                  hex.EncodeToString(bytes.TrimRight(data[headerLength+bodyLength:], "\x00")),
+		}
+		if *chainMap(chain) != *fe.SectorAddressMap {
+			mf.SectorAddressMap = hex.EncodeToString(fe.SectorAddressMap[:])
+		}
+		if len(chain) > 0 {
+			sectorData, _ := di.SectorData(chain[len(chain)-1])
+			if link := sectorData[510:]; link[0] != 0 || link[1] != 0 {
+				mf.EndLink = hex.EncodeToString(link)
+			}
+		}
+		if err := os.WriteFile(filepath.Join(dir, mf.File), data[headerLength:headerLength+bodyLength], 0644); err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, mf)
+	}
+	unallocated := []*Sector{}
+	contents := []byte{}
+	for index := 0; index < DataSectors; index++ {
+		sector := DataSector(index)
+		sectorData, _ := di.SectorData(sector)
+		if inChain[*sector] || *sectorData == (SectorData{}) {
+			continue
+		}
+		unallocated = append(unallocated, sector)
+		contents = append(contents, sectorData[:]...)
+	}
+	if len(unallocated) > 0 {
+		manifest.Unallocated = sectorRuns(unallocated)
+		if err := os.WriteFile(filepath.Join(dir, unallocatedFile), contents, 0644); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, ManifestName), append(data, '\n'), 0644)
+}
+
+// chainMap returns the SectorAddressMap of chain.
+func chainMap(chain []*Sector) *SectorAddressMap {
+	sam := new(SectorAddressMap)
+	for _, sector := range chain {
+		offset, mask := sector.SAMMask()
+		sam[offset] |= mask
+	}
+	return sam
+}
+
+// Pack rebuilds the disk image that Unpack wrote to directory dir.
+// Returns an error if the manifest or a file it names can't be read,
+// or if they don't describe a valid image: for example if a body file
+// has grown too long for its sector chain.
+func Pack(dir string) (*DiskImage, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("cannot parse %v: %v", ManifestName, err)
+	}
+	di := new(DiskImage)
+	for _, slot := range manifest.UnusedSlots {
+		var raw [0x100]byte
+		if err := decodeHex(raw[:], slot.Raw); err != nil {
+			return nil, fmt.Errorf("slot %v: raw: %v", slot.Slot, err)
+		}
+		if err := di.writeSlot(slot.Slot, raw); err != nil {
+			return nil, err
+		}
+	}
+	for _, mf := range manifest.Files {
+		if err := di.packFile(dir, mf); err != nil {
+			return nil, fmt.Errorf("slot %v (%v): %v", mf.Slot, mf.File, err)
+		}
+	}
+	if len(manifest.Unallocated) > 0 {
+		unallocated, err := runSectors(manifest.Unallocated)
+		if err != nil {
+			return nil, fmt.Errorf("unallocated: %v", err)
+		}
+		contents, err := os.ReadFile(filepath.Join(dir, unallocatedFile))
+		if err != nil {
+			return nil, err
+		}
+		if len(contents) != len(unallocated)*512 {
+			return nil, fmt.Errorf("%v is %v bytes but %v unallocated sectors need %v", unallocatedFile, len(contents), len(unallocated), len(unallocated)*512)
+		}
+		for i, sector := range unallocated {
+			di.WriteSector(sector, (*SectorData)(contents[i*512:]))
+		}
+	}
+	return di, nil
+}
+
+// packFile writes the directory entry and sector chain of mf, whose
+// body is in directory dir, to di.
+func (di *DiskImage) packFile(dir string, mf *ManifestFile) error {
+	fe := &FileEntry{
+		Type:                   mf.Type,
+		Sectors:                mf.Sectors,
+		FirstSector:            &Sector{Track: mf.FirstTrack, Sector: mf.FirstSector},
+		StartAddressPage:       mf.StartAddressPage,
+		StartAddressPageOffset: mf.StartAddressPageOffset,
+		Pages:                  mf.Pages,
+		LengthMod16K:           mf.LengthMod16K,
+		ExecutionAddressDiv16K: mf.ExecutionAddressDiv16K,
+		ExecutionAddressMod16K: mf.ExecutionAddressMod16K,
+		SAMBASICStartLine:      mf.ExecutionAddressMod16K,
+		MGTFlags:               mf.MGTFlags,
+	}
+	if fe.Type&FileType(faMask) != 0 {
+		return fmt.Errorf("type %v has attribute bits set", uint8(fe.Type))
+	}
+	attributes, err := parseAttributes(mf.Attributes)
+	if err != nil {
+		return err
+	}
+	fe.Attributes = attributes
+	name := []byte{}
+	for _, r := range mf.Name {
+		if r > 0xff {
+			return fmt.Errorf("name %q has a character outside U+0000–U+00FF", mf.Name)
+		}
+		name = append(name, byte(r))
+	}
+	if len(name) != len(fe.Name) {
+		return fmt.Errorf("name %q is not %v characters", mf.Name, len(fe.Name))
+	}
+	copy(fe.Name[:], name)
+	for _, field := range []struct {
+		name  string
+		dst   []byte
+		value string
+	}{
+		{"file_type_info", fe.FileTypeInfo[:], mf.FileTypeInfo},
+		{"mgt_future_and_past", fe.MGTFutureAndPast[:], mf.MGTFutureAndPast},
+		{"reserved_a", fe.ReservedA[:], mf.ReservedA},
+		{"reserved_b", fe.ReservedB[:], mf.ReservedB},
+	} {
+		if err := decodeHex(field.dst, field.value); err != nil {
+			return fmt.Errorf("%v: %v", field.name, err)
+		}
+	}
+	chain, err := runSectors(mf.Chain)
+	if err != nil {
+		return err
+	}
+	fe.SectorAddressMap = chainMap(chain)
+	if mf.SectorAddressMap != "" {
+		if err := decodeHex(fe.SectorAddressMap[:], mf.SectorAddressMap); err != nil {
+			return fmt.Errorf("sector_address_map: %v", err)
+		}
+	}
+	header, err := hex.DecodeString(mf.Header)
+	if err != nil {
+		return fmt.Errorf("header: %v", err)
+	}
+	body, err := os.ReadFile(filepath.Join(dir, mf.File))
+	if err != nil {
+		return err
+	}
+	slack, err := hex.DecodeString(mf.Slack)
+	if err != nil {
+		return fmt.Errorf("slack: %v", err)
+	}
+	data := append(append(header, body...), slack...)
+	if len(data) > len(chain)*510 {
+		return fmt.Errorf("header, body and slack are %v bytes but the %v sector chain holds %v", len(data), len(chain), len(chain)*510)
+	}
+	endLink := [2]byte{}
+	if mf.EndLink != "" {
+		if err := decodeHex(endLink[:], mf.EndLink); err != nil {
+			return fmt.Errorf("end_link: %v", err)
+		}
+	}
+	for i, sector := range chain {
+		sectorData := SectorData{}
+		copy(sectorData[:510], data[min(i*510, len(data)):])
+		link := endLink[:]
+		if i+1 < len(chain) {
+			link = []byte{chain[i+1].Track, chain[i+1].Sector}
+		}
+		copy(sectorData[510:], link)
+		di.WriteSector(sector, &sectorData)
+	}
+	return di.writeSlot(mf.Slot, fe.Raw())
+}
+
+// min returns the smaller of a and b.
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// writeSlot writes raw to directory slot slot of di.
+func (di *DiskImage) writeSlot(slot int, raw [0x100]byte) error {
+	if slot < 0 || slot >= 80 {
+		return fmt.Errorf("slot %v out of range (0–79)", slot)
+	}
+	copy(di[DirectorySector(slot).Offset()+(slot&1)<<8:], raw[:])
+	return nil
+}
+
+// decodeHex decodes hex string s into dst, which it must fill exactly.
+func decodeHex(dst []byte, s string) error {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	if len(b) != len(dst) {
+		return fmt.Errorf("%v bytes, not %v", len(b), len(dst))
+	}
+	copy(dst, b)
+	return nil
+}
@@ -0,0 +1,99 @@
+package samfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnpackPack(t *testing.T) {
+	di := testImage(t)
+	dir := t.TempDir()
+	if err := di.Unpack(dir); err != nil {
+		t.Fatal(err)
+	}
+	packed, err := Pack(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *packed != *di {
+		for i := range di {
+			if packed[i] != di[i] {
+				t.Fatalf("packed image differs from original, first at offset %v", i)
+			}
+		}
+	}
+	body, err := os.ReadFile(filepath.Join(dir, "02-ETRACK.CHR"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := di.File("ETRACK.CHR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, file.Body) {
+		t.Errorf("unpacked body of ETRACK.CHR differs from File")
+	}
+}
+
+func TestUnpackPackErasedAndLabelled(t *testing.T) {
+	di := NewDiskImage()
+	if err := di.SetLabel("MY DISK"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"ONE", "TWO", "THREE"} {
+		if err := di.AddCodeFile(name, bytes.Repeat([]byte(name), 300), 0x8000, 0x8000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := di.DeleteFile("TWO", false); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := di.Unpack(dir); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != 2 || len(manifest.UnusedSlots) != 1 || manifest.UnusedSlots[0].Slot != 1 || len(manifest.Unallocated) != 1 || manifest.Unallocated[0].Count != 2 {
+		t.Errorf("unexpected manifest %s", data)
+	}
+	packed, err := Pack(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *packed != *di {
+		t.Errorf("packed image differs from original")
+	}
+}
+
+func TestPackErrors(t *testing.T) {
+	dir := t.TempDir()
+	if err := NewDiskImage().Unpack(dir); err != nil {
+		t.Fatal(err)
+	}
+	di := NewDiskImage()
+	if err := di.AddCodeFile("CODE", []byte{1, 2, 3}, 0x8000, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := di.Unpack(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "00-CODE"), make([]byte, 600), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Pack(dir); err == nil {
+		t.Errorf("expected an error packing a body too long for its chain")
+	}
+	if _, err := Pack(t.TempDir()); err == nil {
+		t.Errorf("expected an error packing a directory without a manifest")
+	}
+}
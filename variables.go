@@ -0,0 +1,40 @@
+package samfile
+
+import (
+	"fmt"
+
+	"github.com/petemoore/samfile/v3/sambasic"
+)
+
+// Variables decodes the variables saved with the named FT_SAM_BASIC
+// file (see sambasic.DecodeVariables). Returns an error if the file is
+// not present on disk, is not a SAM BASIC program, or its variables
+// can't be decoded.
+func (di *DiskImage) Variables(name string) (*sambasic.Variables, error) {
+	dj := di.DiskJournal()
+	slot, err := dj.findFileEntry(name)
+	if err != nil {
+		return nil, err
+	}
+	return di.ReadVariables(dj[slot])
+}
+
+// ReadVariables decodes the variables saved with the FT_SAM_BASIC file
+// described by fe, as Variables does, using the section sizes recorded
+// in fe's FileTypeInfo to find the NVARS and SAVARS areas.
+func (di *DiskImage) ReadVariables(fe *FileEntry) (*sambasic.Variables, error) {
+	if fe.Type != FT_SAM_BASIC {
+		return nil, fmt.Errorf("file %v is %v, not a SAM BASIC program", fe.Name, fe.Type)
+	}
+	f, err := di.ReadFile(fe)
+	if err != nil {
+		return nil, err
+	}
+	program := fe.ProgramLength()
+	numEnd := program + fe.NumericVariablesSize()
+	saVars := numEnd + fe.GapSize()
+	if program > numEnd || numEnd > saVars || saVars > uint32(len(f.Body)) {
+		return nil, fmt.Errorf("file %v has section sizes (program %v, numeric variables %v, gap %v) that don't fit its %v byte body", fe.Name, program, int64(numEnd)-int64(program), int64(saVars)-int64(numEnd), len(f.Body))
+	}
+	return sambasic.DecodeVariables(f.Body[:program], fe.StartAddress(), f.Body[program:numEnd], f.Body[saVars:])
+}
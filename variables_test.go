@@ -0,0 +1,39 @@
+package samfile
+
+import (
+	"testing"
+)
+
+func TestVariables(t *testing.T) {
+	di := testImage(t)
+	vars, err := di.Variables("PRINTSONG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	numbers := map[string]float64{}
+	for _, n := range vars.Numbers {
+		numbers[n.Name] = n.Value
+		if n.Name == "f" {
+			if n.For == nil || n.For.Limit != 139134 || n.For.Step != 18 || n.For.Line != 30 || n.For.Statement != 1 {
+				t.Errorf("unexpected FOR loop %+v", n.For)
+			}
+		}
+	}
+	if numbers["pat"] != 137984 || numbers["xrg"] != 256 || numbers["f"] != 139136 {
+		t.Errorf("unexpected numeric variables %v", numbers)
+	}
+	if len(vars.Strings) != 2 || vars.Strings[0].Name != "b" || vars.Strings[0].Value != "---" {
+		t.Errorf("unexpected string variables %+v", vars.Strings)
+	}
+
+	vars, err = di.Variables("ETRACKER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vars.Arrays) != 1 || vars.Arrays[0].String() != "n$(10)" {
+		t.Errorf("unexpected arrays %v", vars.Arrays)
+	}
+	if _, err := di.Variables("ETRACK.CHR"); err == nil {
+		t.Errorf("expected an error decoding variables of a code file")
+	}
+}